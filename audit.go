@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/trijpstra-fourlights/cert-manager-webhook-hetzner/internal"
+	"k8s.io/client-go/kubernetes"
+)
+
+// auditOptions configures the audit log of DNS changes.
+type auditOptions struct {
+	// Output is stdout, a file path, or empty to disable the JSON lines stream.
+	Output string
+	// ConfigMap additionally keeps the latest MaxEntries events in a ConfigMap, if set.
+	ConfigMap  string
+	MaxEntries int
+}
+
+// auditOptionsFromEnv reads the audit options from AUDIT_LOG, AUDIT_CONFIGMAP and
+// AUDIT_CONFIGMAP_MAX_ENTRIES.
+func auditOptionsFromEnv() (auditOptions, error) {
+	opts := auditOptions{
+		Output:     os.Getenv("AUDIT_LOG"),
+		ConfigMap:  os.Getenv("AUDIT_CONFIGMAP"),
+		MaxEntries: 1000,
+	}
+
+	if v := os.Getenv("AUDIT_CONFIGMAP_MAX_ENTRIES"); v != "" {
+		var err error
+		if opts.MaxEntries, err = strconv.Atoi(v); err != nil {
+			return opts, fmt.Errorf("invalid AUDIT_CONFIGMAP_MAX_ENTRIES `%s`; %v", v, err)
+		}
+		if opts.MaxEntries <= 0 {
+			return opts, fmt.Errorf("AUDIT_CONFIGMAP_MAX_ENTRIES must be positive, got `%d`", opts.MaxEntries)
+		}
+	}
+
+	return opts, nil
+}
+
+// newAuditLog returns the audit log configured by opts, or nil when auditing is disabled.
+func newAuditLog(client kubernetes.Interface, opts auditOptions) (*internal.AuditLog, error) {
+	var sinks []internal.AuditSink
+	switch opts.Output {
+	case "":
+	case "stdout", "-":
+		// Logs go to stderr, so the stream on stdout only contains audit events
+		sinks = append(sinks, internal.NewJSONLinesAuditSink(os.Stdout))
+	default:
+		file, err := os.OpenFile(opts.Output, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open audit log `%s`; %v", opts.Output, err)
+		}
+		sinks = append(sinks, internal.NewJSONLinesAuditSink(file))
+	}
+	if opts.ConfigMap != "" {
+		sinks = append(sinks, internal.NewConfigMapAuditSink(client, webhookNamespace(), opts.ConfigMap, opts.MaxEntries))
+	}
+
+	if len(sinks) == 0 {
+		return nil, nil
+	}
+	return internal.NewAuditLog(sinks...), nil
+}
+
+// auditChange records the change of record by source, requested by the challenge with uid
+// if known, to the audit log.
+func (c *hetznerDNSProviderSolver) auditChange(ctx context.Context, operation, source string, record internal.OwnedRecord, challenge *internal.ChallengeRecorder, err error) {
+	event := internal.AuditEvent{
+		Operation: operation,
+		Source:    source,
+		Zone:      record.ZoneName,
+		Name:      record.Name,
+		Type:      "TXT",
+		ValueHash: internal.AuditValueHash(record.Value),
+		RecordId:  record.RecordId,
+	}
+	if ref := challenge.Challenge(); ref != nil {
+		event.Namespace = ref.Namespace
+		event.ChallengeUID = string(ref.UID)
+	}
+	c.audit.Record(ctx, event, err)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	neturl "net/url"
+
+	"github.com/trijpstra-fourlights/cert-manager-webhook-hetzner/internal"
+	"k8s.io/klog/v2"
+)
+
+// dnsBackend manages challenge TXT records through one of the Hetzner DNS APIs.
+type dnsBackend interface {
+	// zoneId returns the id of the zone config.ZoneName, or an empty string when it does
+	// not exist.
+	zoneId(ctx context.Context, config internal.Config) (string, error)
+	// zones lists all zones accessible with config.ApiKey.
+	zones(ctx context.Context, config internal.Config) ([]internal.ZoneInfo, error)
+	// txtRecords lists the TXT records of the zone, one per value. Values are decoded from
+	// their presentation form.
+	txtRecords(ctx context.Context, config internal.Config, zoneId string) ([]internal.Record, error)
+	// addTxtRecord adds the TXT value at name in the zone, leaving other values of the
+	// name untouched.
+	addTxtRecord(ctx context.Context, config internal.Config, zoneId, name, value string, labels map[string]string) (internal.Record, error)
+	// deleteTxtRecord removes exactly the value of record, leaving other values of its
+	// name untouched.
+	deleteTxtRecord(ctx context.Context, config internal.Config, record internal.OwnedRecord) error
+}
+
+// backendFor returns the backend speaking the API of config.
+func backendFor(config internal.Config) dnsBackend {
+	if internal.ApiFlavor(config.ApiFlavor, config.ApiUrl) == internal.ApiFlavorCloud {
+		return cloudBackend{}
+	}
+	return legacyBackend{}
+}
+
+// legacyBackend speaks the DNS API of dns.hetzner.com, which stores every TXT value as a
+// record of its own.
+type legacyBackend struct{}
+
+func (legacyBackend) zoneId(ctx context.Context, config internal.Config) (string, error) {
+	url := config.ApiUrl + "/zones?name=" + neturl.QueryEscape(config.ZoneName)
+
+	// Get Zone configuration
+	zoneRecords, err := callDnsApi(ctx, url, "GET", nil, config)
+
+	if err != nil {
+		// Propagate API call errors
+		return "", fmt.Errorf("API error getting zone info for '%s': %v", config.ZoneName, err)
+	}
+
+	// Unmarshall response
+	zones := internal.ZoneResponse{}
+	readErr := json.Unmarshal(zoneRecords, &zones)
+
+	if readErr != nil {
+		return "", fmt.Errorf("unable to unmarshal zone response for '%s': %v", config.ZoneName, readErr)
+	}
+
+	// Check the number of zones returned
+	if zones.Meta.Pagination.TotalEntries == 0 {
+		// Explicitly return empty string and nil error if zone is not found
+		return "", nil
+	}
+
+	if zones.Meta.Pagination.TotalEntries > 1 {
+		// This case should ideally not happen if Hetzner API guarantees unique zone names
+		klog.FromContext(ctx).Info("Found multiple zones for name", "zone", config.ZoneName, "count", zones.Meta.Pagination.TotalEntries)
+		// Return error as this is unexpected
+		return "", fmt.Errorf("unexpected number of zones (%d) found for name '%s'", zones.Meta.Pagination.TotalEntries, config.ZoneName)
+	}
+
+	// Exactly one zone found
+	return zones.Zones[0].Id, nil
+}
+
+func (legacyBackend) zones(ctx context.Context, config internal.Config) ([]internal.ZoneInfo, error) {
+	var zones []internal.ZoneInfo
+	for page := 1; ; page++ {
+		body, err := callDnsApi(ctx, fmt.Sprintf("%s/zones?page=%d&per_page=100", config.ApiUrl, page), "GET", nil, config)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list zones; %w", err)
+		}
+
+		response := internal.ZoneResponse{}
+		if err := json.Unmarshal(body, &response); err != nil {
+			return nil, fmt.Errorf("unable to unmarshal zone response; %w", err)
+		}
+		for _, zone := range response.Zones {
+			zones = append(zones, zone.Info())
+		}
+
+		if page >= response.Meta.Pagination.LastPage {
+			return zones, nil
+		}
+	}
+}
+
+func (legacyBackend) txtRecords(ctx context.Context, config internal.Config, zoneId string) ([]internal.Record, error) {
+	dnsRecords, err := callDnsApi(ctx, config.ApiUrl+"/records?zone_id="+zoneId, "GET", nil, config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get DNS records %w", err)
+	}
+
+	// Unmarshall response
+	records := internal.RecordResponse{}
+	if err := json.Unmarshal(dnsRecords, &records); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal response %v", err)
+	}
+
+	var txt []internal.Record
+	for _, record := range records.Records {
+		if record.Type == "TXT" {
+			record.Value = internal.DecodeTxt(record.Value)
+			txt = append(txt, record)
+		}
+	}
+	return txt, nil
+}
+
+func (legacyBackend) addTxtRecord(ctx context.Context, config internal.Config, zoneId, name, value string, _ map[string]string) (internal.Record, error) {
+	var jsonStr = fmt.Sprintf(`{"value":%q, "ttl":120, "type":"TXT", "name":%q, "zone_id":%q}`, internal.EncodeTxt(value), name, zoneId)
+
+	add, err := callDnsApi(ctx, config.ApiUrl+"/records", "POST", bytes.NewBuffer([]byte(jsonStr)), config)
+
+	if err != nil {
+		return internal.Record{}, fmt.Errorf("unable to add TXT record `%s` to zone `%s`; %w", name, config.ZoneName, err)
+	}
+
+	// Unmarshall response
+	created := internal.RecordCreateResponse{}
+	if err := json.Unmarshal(add, &created); err != nil {
+		return internal.Record{}, fmt.Errorf("unable to unmarshal response %v", err)
+	}
+	created.Record.Value = internal.DecodeTxt(created.Record.Value)
+	klog.FromContext(ctx).Info("Added TXT record", "record", created.Record.Id, "name", name)
+
+	return created.Record, nil
+}
+
+func (legacyBackend) deleteTxtRecord(ctx context.Context, config internal.Config, record internal.OwnedRecord) error {
+	if _, err := callDnsApi(ctx, config.ApiUrl+"/records/"+record.RecordId, "DELETE", nil, config); err != nil {
+		return err
+	}
+	klog.FromContext(ctx).Info("Deleted TXT record", "record", record.RecordId, "name", record.Name)
+
+	return nil
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/spf13/cobra"
+	"github.com/trijpstra-fourlights/cert-manager-webhook-hetzner/internal"
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/klog/v2"
+)
+
+// cliTokenEnv holds the API token used by the CLI commands, unless --token-file is set.
+const cliTokenEnv = "HETZNER_API_TOKEN"
+
+// cliOptions are the flags of the CLI commands, describing a challenge like cert-manager
+// passes it to the webhook.
+type cliOptions struct {
+	fqdn      string
+	zone      string
+	key       string
+	namespace string
+	config    string
+	tokenFile string
+}
+
+// cliCommands returns the commands running the solver outside the webhook server, for
+// debugging issuer configurations without cert-manager.
+func cliCommands() []*cobra.Command {
+	present := &cobra.Command{
+		Use:          "present",
+		Short:        "Add the TXT record of a challenge, like Present",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+	}
+	presentOpts := addCLIFlags(present, true)
+	present.RunE = func(cmd *cobra.Command, _ []string) error {
+		solver, ch, err := presentOpts.challenge()
+		if err != nil {
+			return err
+		}
+		if err := solver.Present(ch); err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(cmd.OutOrStdout(), "Presented TXT record for %s\n", ch.ResolvedFQDN)
+		return err
+	}
+
+	cleanup := &cobra.Command{
+		Use:          "cleanup",
+		Short:        "Delete the TXT record of a challenge, like CleanUp",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+	}
+	cleanupOpts := addCLIFlags(cleanup, true)
+	cleanup.RunE = func(cmd *cobra.Command, _ []string) error {
+		solver, ch, err := cleanupOpts.challenge()
+		if err != nil {
+			return err
+		}
+		if err := solver.CleanUp(ch); err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(cmd.OutOrStdout(), "Cleaned up TXT record for %s\n", ch.ResolvedFQDN)
+		return err
+	}
+
+	listRecords := &cobra.Command{
+		Use:          "list-records",
+		Short:        "List the TXT records of the zone resolved for an FQDN",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+	}
+	listOpts := addCLIFlags(listRecords, false)
+	listRecords.RunE = func(cmd *cobra.Command, _ []string) error {
+		solver, ch, err := listOpts.challenge()
+		if err != nil {
+			return err
+		}
+		ctx := withCLIContext(cmd.Context())
+		config, err := clientConfig(ctx, solver, ch)
+		if err != nil {
+			return err
+		}
+		zoneId, err := searchZoneId(ctx, config)
+		if err != nil {
+			return err
+		}
+		if zoneId == "" {
+			return &internal.ZoneNotFoundError{Domain: config.ZoneName}
+		}
+		records, err := backendFor(config).txtRecords(ctx, config, zoneId)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tVALUE\tID")
+		for _, record := range records {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", record.Name, record.Value, record.Id)
+		}
+		return w.Flush()
+	}
+
+	resolveZone := &cobra.Command{
+		Use:          "resolve-zone",
+		Short:        "Show the zone, record name and API an FQDN resolves to",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+	}
+	resolveOpts := addCLIFlags(resolveZone, false)
+	resolveZone.RunE = func(cmd *cobra.Command, _ []string) error {
+		solver, ch, err := resolveOpts.challenge()
+		if err != nil {
+			return err
+		}
+		ctx := withCLIContext(cmd.Context())
+		config, err := clientConfig(ctx, solver, ch)
+		if err != nil {
+			return err
+		}
+		zoneId, err := searchZoneId(ctx, config)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "FQDN:\t%s\n", config.Fqdn)
+		fmt.Fprintf(w, "Zone:\t%s\n", config.ZoneName)
+		fmt.Fprintf(w, "Zone ID:\t%s\n", zoneId)
+		fmt.Fprintf(w, "Record name:\t%s\n", recordName(config.Fqdn, config.ZoneName))
+		fmt.Fprintf(w, "API:\t%s (%s)\n", config.ApiUrl, config.ApiFlavor)
+		return w.Flush()
+	}
+
+	return []*cobra.Command{present, cleanup, listRecords, resolveZone, doctorCommand()}
+}
+
+// addCLIFlags adds the flags of a CLI command to cmd, including the challenge key when
+// withKey is set.
+func addCLIFlags(cmd *cobra.Command, withKey bool) *cliOptions {
+	opts := &cliOptions{}
+	flags := cmd.Flags()
+	flags.StringVar(&opts.fqdn, "fqdn", "", "Challenge FQDN, e.g. _acme-challenge.example.com.")
+	flags.StringVar(&opts.zone, "zone", "", "Zone cert-manager resolved for the FQDN, searched from the FQDN's parent by default")
+	flags.StringVar(&opts.namespace, "namespace", "default", "Namespace of the challenge")
+	flags.StringVar(&opts.config, "config", "{}", "Solver config JSON as in the issuer, or @file to read it from a file")
+	flags.StringVar(&opts.tokenFile, "token-file", "", "File holding the Hetzner API token, instead of $"+cliTokenEnv)
+	_ = cmd.MarkFlagRequired("fqdn")
+	if withKey {
+		flags.StringVar(&opts.key, "key", "", "Challenge key, the value of the TXT record")
+		_ = cmd.MarkFlagRequired("key")
+	}
+
+	// The logging flags of the webhook server only apply to its own command
+	verbosity := flag.NewFlagSet("", flag.ContinueOnError)
+	klog.InitFlags(verbosity)
+	flags.AddGoFlag(verbosity.Lookup("v"))
+
+	return opts
+}
+
+// challenge returns a solver using the token of the options instead of Kubernetes
+// secrets, and the challenge they describe.
+func (o *cliOptions) challenge() (*hetznerDNSProviderSolver, *v1alpha1.ChallengeRequest, error) {
+	token, err := o.token()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	config := []byte(o.config)
+	if path, ok := strings.CutPrefix(o.config, "@"); ok {
+		if config, err = os.ReadFile(path); err != nil {
+			return nil, nil, fmt.Errorf("unable to read config `%s`; %v", path, err)
+		}
+	}
+	if _, err := loadConfig(&extapi.JSON{Raw: config}); err != nil {
+		return nil, nil, err
+	}
+
+	fqdn := o.fqdn
+	if !strings.HasSuffix(fqdn, ".") {
+		fqdn += "."
+	}
+	zone := o.zone
+	if zone == "" {
+		zone = strings.TrimPrefix(fqdn, "_acme-challenge.")
+	}
+
+	ch := &v1alpha1.ChallengeRequest{
+		Type:              "dns-01",
+		DNSName:           strings.TrimSuffix(strings.TrimPrefix(fqdn, "_acme-challenge."), "."),
+		Key:               o.key,
+		ResourceNamespace: o.namespace,
+		ResolvedFQDN:      fqdn,
+		ResolvedZone:      zone,
+		Config:            &extapi.JSON{Raw: config},
+	}
+	return &hetznerDNSProviderSolver{apiToken: token}, ch, nil
+}
+
+// token returns the API token from --token-file or the environment.
+func (o *cliOptions) token() (string, error) {
+	token := os.Getenv(cliTokenEnv)
+	if o.tokenFile != "" {
+		data, err := os.ReadFile(o.tokenFile)
+		if err != nil {
+			return "", fmt.Errorf("unable to read token file `%s`; %v", o.tokenFile, err)
+		}
+		token = string(data)
+	}
+
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", errors.New("no API token, set " + cliTokenEnv + " or --token-file")
+	}
+	internal.RegisterSecret(token)
+	return token, nil
+}
+
+// withCLIContext returns ctx for CLI commands, with a logger redacting secrets.
+func withCLIContext(ctx context.Context) context.Context {
+	return klog.NewContext(ctx, internal.NewLogger().WithName("cli"))
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/trijpstra-fourlights/cert-manager-webhook-hetzner/internal"
+	"github.com/trijpstra-fourlights/cert-manager-webhook-hetzner/internal/hetznertest"
+)
+
+// runCLI runs the CLI command of args and returns its output.
+func runCLI(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+
+	command := &cobra.Command{Use: "webhook", SilenceErrors: true}
+	command.AddCommand(cliCommands()...)
+	var out bytes.Buffer
+	command.SetOut(&out)
+	command.SetErr(&out)
+	command.SetArgs(args)
+
+	err := command.Execute()
+	return out.String(), err
+}
+
+func TestCLICommands(t *testing.T) {
+	for _, flavor := range []string{internal.ApiFlavorLegacy, internal.ApiFlavorCloud} {
+		t.Run(flavor, func(t *testing.T) {
+			fake := hetznertest.NewServer(t, fakeToken)
+			fake.AddZone(hetznertest.Zone{Name: "example.com"})
+			t.Setenv(cliTokenEnv, fakeToken)
+			config := fmt.Sprintf(`{"apiUrl":%q,"apiFlavor":%q}`, fake.URL(flavor), flavor)
+			challenge := []string{"--fqdn", "_acme-challenge.www.example.com", "--config", config}
+
+			testCases := []struct {
+				args           []string
+				expectedOutput []string
+				expectedTxt    []string
+			}{
+				{
+					[]string{"present", "--key", "key1"},
+					[]string{"Presented TXT record for _acme-challenge.www.example.com."},
+					[]string{"key1"},
+				},
+				{
+					[]string{"list-records"},
+					[]string{"NAME", "_acme-challenge.www", "key1"},
+					[]string{"key1"},
+				},
+				{
+					[]string{"resolve-zone"},
+					[]string{"example.com", "_acme-challenge.www", fake.URL(flavor) + " (" + flavor + ")"},
+					[]string{"key1"},
+				},
+				{
+					[]string{"cleanup", "--key", "key1"},
+					[]string{"Cleaned up TXT record for _acme-challenge.www.example.com."},
+					nil,
+				},
+			}
+
+			for _, tc := range testCases {
+				out, err := runCLI(t, append(tc.args, challenge...)...)
+				if err != nil {
+					t.Fatalf("Expected no error for %s, but got: %v", tc.args[0], err)
+				}
+				for _, expected := range tc.expectedOutput {
+					if !strings.Contains(out, expected) {
+						t.Errorf("Expected the output of %s to contain %q, but got:\n%s", tc.args[0], expected, out)
+					}
+				}
+				if values := fake.TXT("example.com", "_acme-challenge.www"); !reflect.DeepEqual(values, tc.expectedTxt) {
+					t.Errorf("Expected %v after %s, but got %v", tc.expectedTxt, tc.args[0], values)
+				}
+			}
+		})
+	}
+}
+
+func TestCLIToken(t *testing.T) {
+	fake := hetznertest.NewServer(t, fakeToken)
+	fake.AddZone(hetznertest.Zone{Name: "example.com"})
+	config := fmt.Sprintf(`{"apiUrl":%q}`, fake.URL(internal.ApiFlavorLegacy))
+	args := []string{"resolve-zone", "--fqdn", "_acme-challenge.example.com", "--config", config}
+
+	t.Setenv(cliTokenEnv, "")
+	if _, err := runCLI(t, args...); err == nil || !strings.Contains(err.Error(), cliTokenEnv) {
+		t.Errorf("Expected an error naming %s, but got: %v", cliTokenEnv, err)
+	}
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte(fakeToken+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	out, err := runCLI(t, append(args, "--token-file", tokenFile)...)
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	if !strings.Contains(out, "example.com") {
+		t.Errorf("Expected the resolved zone, but got:\n%s", out)
+	}
+}
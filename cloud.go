@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	neturl "net/url"
+	"strconv"
+	"time"
+
+	"github.com/trijpstra-fourlights/cert-manager-webhook-hetzner/internal"
+	"go.opentelemetry.io/otel/attribute"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// cloudActionTimeout bounds the wait for an asynchronous Cloud API action.
+	cloudActionTimeout      = 2 * time.Minute
+	cloudActionPollInterval = time.Second
+)
+
+// cloudBackend speaks the DNS API of the Hetzner Cloud, which stores all TXT values of a
+// name in a single rrset. Values are only ever added and removed with the rrset actions, so
+// that concurrent challenges for the same name never drop each other's values.
+type cloudBackend struct{}
+
+// rrsetUrl returns the URL of the TXT rrset name in zoneId.
+func rrsetUrl(config internal.Config, zoneId, name string) string {
+	return config.ApiUrl + "/zones/" + neturl.PathEscape(zoneId) + "/rrsets/" + neturl.PathEscape(name) + "/TXT"
+}
+
+func (cloudBackend) zoneId(ctx context.Context, config internal.Config) (string, error) {
+	url := config.ApiUrl + "/zones?name=" + neturl.QueryEscape(config.ZoneName)
+
+	body, err := callDnsApi(ctx, url, "GET", nil, config)
+	if err != nil {
+		return "", fmt.Errorf("API error getting zone info for '%s': %v", config.ZoneName, err)
+	}
+
+	zones := internal.CloudZoneResponse{}
+	if err := json.Unmarshal(body, &zones); err != nil {
+		return "", fmt.Errorf("unable to unmarshal zone response for '%s': %v", config.ZoneName, err)
+	}
+
+	switch len(zones.Zones) {
+	case 0:
+		return "", nil
+	case 1:
+		return strconv.FormatInt(zones.Zones[0].Id, 10), nil
+	default:
+		return "", fmt.Errorf("unexpected number of zones (%d) found for name '%s'", len(zones.Zones), config.ZoneName)
+	}
+}
+
+func (cloudBackend) zones(ctx context.Context, config internal.Config) ([]internal.ZoneInfo, error) {
+	var zones []internal.ZoneInfo
+	for page := 1; ; page++ {
+		body, err := callDnsApi(ctx, fmt.Sprintf("%s/zones?page=%d&per_page=100", config.ApiUrl, page), "GET", nil, config)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list zones; %w", err)
+		}
+
+		response := internal.CloudZoneResponse{}
+		if err := json.Unmarshal(body, &response); err != nil {
+			return nil, fmt.Errorf("unable to unmarshal zone response; %w", err)
+		}
+		for _, zone := range response.Zones {
+			zones = append(zones, zone.Info())
+		}
+
+		if page >= response.Meta.Pagination.LastPage {
+			return zones, nil
+		}
+	}
+}
+
+func (cloudBackend) txtRecords(ctx context.Context, config internal.Config, zoneId string) ([]internal.Record, error) {
+	var records []internal.Record
+	for page := 1; ; page++ {
+		url := fmt.Sprintf("%s/zones/%s/rrsets?type=TXT&page=%d&per_page=100", config.ApiUrl, neturl.PathEscape(zoneId), page)
+		body, err := callDnsApi(ctx, url, "GET", nil, config)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get DNS records %w", err)
+		}
+
+		rrsets := internal.CloudRRSetsResponse{}
+		if err := json.Unmarshal(body, &rrsets); err != nil {
+			return nil, fmt.Errorf("unable to unmarshal response %v", err)
+		}
+		records = append(records, internal.CloudRecords(zoneId, rrsets.RRSets)...)
+
+		if page >= rrsets.Meta.Pagination.LastPage {
+			return records, nil
+		}
+	}
+}
+
+func (b cloudBackend) addTxtRecord(ctx context.Context, config internal.Config, zoneId, name, value string, labels map[string]string) (internal.Record, error) {
+	record := internal.Record{
+		Type:   "TXT",
+		Id:     internal.CloudRecordId(zoneId, name, value),
+		ZoneId: zoneId,
+		Name:   name,
+		Value:  value,
+		Ttl:    120,
+	}
+	records := []internal.CloudRecord{{Value: internal.EncodeTxt(value)}}
+
+	rrset, err := b.rrset(ctx, config, zoneId, name)
+	switch {
+	case internal.IsNotFound(err):
+		// Only a new rrset gets the labels. They describe the rrset as a whole, so those of an
+		// rrset shared with other clusters are left as they are; the values of each cluster
+		// are told apart by the ownership store instead
+		create, _ := json.Marshal(internal.CloudRRSet{Name: name, Type: "TXT", Ttl: record.Ttl, Labels: labels, Records: records})
+		var created []byte
+		created, err = callDnsApi(ctx, config.ApiUrl+"/zones/"+neturl.PathEscape(zoneId)+"/rrsets", "POST", bytes.NewBuffer(create), config)
+		if err == nil {
+			if err := waitForAction(ctx, config, created); err != nil {
+				return internal.Record{}, fmt.Errorf("unable to add TXT record `%s` to zone `%s`; %v", name, config.ZoneName, err)
+			}
+			klog.FromContext(ctx).Info("Created TXT rrset", "name", name)
+			return record, nil
+		}
+		if !internal.IsConflict(err) {
+			return internal.Record{}, fmt.Errorf("unable to add TXT record `%s` to zone `%s`; %w", name, config.ZoneName, err)
+		}
+		// Created concurrently by another challenge, add the value to it instead
+	case err != nil:
+		return internal.Record{}, fmt.Errorf("unable to add TXT record `%s` to zone `%s`; %w", name, config.ZoneName, err)
+	case hasValue(rrset, value):
+		klog.FromContext(ctx).Info("TXT rrset already contains the challenge key", "name", name)
+		return record, nil
+	}
+
+	add, _ := json.Marshal(internal.CloudRecordsRequest{Ttl: record.Ttl, Records: records})
+	added, err := callDnsApi(ctx, rrsetUrl(config, zoneId, name)+"/actions/add_records", "POST", bytes.NewBuffer(add), config)
+	if err == nil {
+		err = waitForAction(ctx, config, added)
+	}
+	if err != nil {
+		return internal.Record{}, fmt.Errorf("unable to add TXT record `%s` to zone `%s`; %w", name, config.ZoneName, err)
+	}
+	klog.FromContext(ctx).Info("Added challenge key to TXT rrset", "name", name)
+
+	return record, nil
+}
+
+func (b cloudBackend) deleteTxtRecord(ctx context.Context, config internal.Config, record internal.OwnedRecord) error {
+	url := rrsetUrl(config, record.ZoneId, record.Name)
+
+	rrset, err := b.rrset(ctx, config, record.ZoneId, record.Name)
+	if err != nil {
+		return err
+	}
+	stored, ok := rrset.FindValue(record.Value)
+	if !ok {
+		klog.FromContext(ctx).Info("TXT rrset no longer contains the challenge key", "name", record.Name, "zone", record.ZoneName)
+		return nil
+	}
+
+	// Remove the value exactly as stored, which may differ from our encoding in quoting
+	remove, _ := json.Marshal(internal.CloudRecordsRequest{Records: []internal.CloudRecord{{Value: stored.Value}}})
+	removed, err := callDnsApi(ctx, url+"/actions/remove_records", "POST", bytes.NewBuffer(remove), config)
+	if err != nil {
+		return err
+	}
+	if err := waitForAction(ctx, config, removed); err != nil {
+		return err
+	}
+	// The API deletes the rrset together with its last value. Deleting it here once it looks
+	// empty could drop values added concurrently by other replicas or clusters
+	klog.FromContext(ctx).Info("Removed challenge key from TXT rrset", "name", record.Name, "zone", record.ZoneName)
+
+	return nil
+}
+
+// rrset returns the TXT rrset name in zoneId.
+func (cloudBackend) rrset(ctx context.Context, config internal.Config, zoneId, name string) (internal.CloudRRSet, error) {
+	body, err := callDnsApi(ctx, rrsetUrl(config, zoneId, name), "GET", nil, config)
+	if err != nil {
+		return internal.CloudRRSet{}, err
+	}
+
+	rrset := internal.CloudRRSetResponse{}
+	if err := json.Unmarshal(body, &rrset); err != nil {
+		return internal.CloudRRSet{}, fmt.Errorf("unable to unmarshal response %v", err)
+	}
+	return rrset.RRSet, nil
+}
+
+// waitForAction waits until the action started by the mutation that answered body has
+// completed, for at most cloudActionTimeout. Responses without an action complete
+// immediately.
+func waitForAction(ctx context.Context, config internal.Config, body []byte) (err error) {
+	started := internal.CloudActionResponse{}
+	if err := json.Unmarshal(body, &started); err != nil {
+		return fmt.Errorf("unable to unmarshal response %v", err)
+	}
+	if started.Action == nil {
+		return nil
+	}
+
+	ctx, span := internal.StartSpan(ctx, "wait for action",
+		attribute.Int64("action.id", started.Action.Id),
+		attribute.String("action.command", started.Action.Command),
+	)
+	defer func() { internal.EndSpan(span, err) }()
+	ctx, cancel := context.WithTimeout(ctx, cloudActionTimeout)
+	defer cancel()
+
+	return internal.WaitForAction(ctx, *started.Action, func(id int64) (internal.CloudAction, error) {
+		body, err := callDnsApi(ctx, config.ApiUrl+"/zones/actions/"+strconv.FormatInt(id, 10), "GET", nil, config)
+		if err != nil {
+			return internal.CloudAction{}, err
+		}
+
+		action := internal.CloudActionResponse{}
+		if err := json.Unmarshal(body, &action); err != nil {
+			return internal.CloudAction{}, fmt.Errorf("unable to unmarshal response %v", err)
+		}
+		if action.Action == nil {
+			return internal.CloudAction{}, fmt.Errorf("response does not contain action %d", id)
+		}
+		return *action.Action, nil
+	}, cloudActionPollInterval)
+}
+
+func hasValue(rrset internal.CloudRRSet, value string) bool {
+	_, ok := rrset.FindValue(value)
+	return ok
+}
@@ -46,3 +46,15 @@ Create chart name and version as used by the chart label.
 {{- define "cert-manager-webhook-hetzner.servingCertificate" -}}
 {{ printf "%s-webhook-tls" (include "cert-manager-webhook-hetzner.fullname" .) }}
 {{- end -}}
+
+{{- define "cert-manager-webhook-hetzner.ownershipConfigMap" -}}
+{{ printf "%s-ownership" (include "cert-manager-webhook-hetzner.fullname" .) }}
+{{- end -}}
+
+{{- define "cert-manager-webhook-hetzner.deletionQueueConfigMap" -}}
+{{ printf "%s-pending-deletions" (include "cert-manager-webhook-hetzner.fullname" .) }}
+{{- end -}}
+
+{{- define "cert-manager-webhook-hetzner.auditConfigMap" -}}
+{{ printf "%s-audit" (include "cert-manager-webhook-hetzner.fullname" .) }}
+{{- end -}}
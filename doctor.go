@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/spf13/cobra"
+	"github.com/trijpstra-fourlights/cert-manager-webhook-hetzner/internal"
+)
+
+// doctorValuePrefix starts the value of the throwaway TXT record written by the doctor
+// command, so that a leftover record is recognizable.
+const doctorValuePrefix = "cert-manager-webhook-hetzner-doctor-"
+
+// Names of the doctor checks, in the order they run.
+const (
+	checkConfig     = "Configuration"
+	checkAPI        = "API access"
+	checkZone       = "Zone"
+	checkRecord     = "Test record"
+	checkDelegation = "Delegation"
+)
+
+// doctorCommand returns the command checking that the token and zone used for an FQDN
+// allow solving challenges, for onboarding new domains.
+func doctorCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "doctor",
+		Short:        "Check the API access, zone and delegation used for an FQDN",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+	}
+	opts := addCLIFlags(cmd, false)
+	cmd.RunE = func(cmd *cobra.Command, _ []string) error {
+		solver, ch, err := opts.challenge()
+		if err != nil {
+			return err
+		}
+
+		report := runDoctor(withCLIContext(cmd.Context()), solver, ch)
+		if err := report.Write(cmd.OutOrStdout()); err != nil {
+			return err
+		}
+		if failures := report.Failures(); failures > 0 {
+			return fmt.Errorf("%d of %d checks failed", failures, len(report.Checks))
+		}
+		return nil
+	}
+	return cmd
+}
+
+// runDoctor checks the API flavor and token, the zone of ch, that a TXT record can be
+// created and deleted in it, and that it is delegated to Hetzner. Checks depending on a
+// failed one are skipped.
+func runDoctor(ctx context.Context, c *hetznerDNSProviderSolver, ch *v1alpha1.ChallengeRequest) *internal.DoctorReport {
+	report := &internal.DoctorReport{}
+
+	config, cfg, err := apiConfig(ctx, c, ch)
+	if !report.Check(checkConfig, fmt.Sprintf("record %s via the %s API at %s", config.Fqdn, config.ApiFlavor, config.ApiUrl), err) {
+		report.Skip(checkAPI, checkZone, checkRecord, checkDelegation)
+		return report
+	}
+
+	backend := backendFor(config)
+	zones, err := backend.zones(ctx, config)
+	if err == nil && len(zones) == 0 {
+		err = errors.New("no zones accessible with the token")
+	}
+	if !report.Check(checkAPI, fmt.Sprintf("%d zones accessible: %s", len(zones), zoneNames(zones)), apiAccessError(config, err)) {
+		report.Skip(checkZone, checkRecord, checkDelegation)
+		return report
+	}
+
+	config, err = clientConfig(ctx, c, ch)
+	var zone internal.ZoneInfo
+	if err == nil {
+		zone, err = findZone(zones, config.ZoneName)
+	}
+	detail := fmt.Sprintf("%s (id %s)", zone.Name, zone.Id)
+	if zone.Status != "" {
+		detail = fmt.Sprintf("%s (id %s, status %s)", zone.Name, zone.Id, zone.Status)
+	}
+	if !report.Check(checkZone, detail, err) {
+		report.Skip(checkRecord, checkDelegation)
+		return report
+	}
+
+	name := recordName(config.Fqdn, zone.Name)
+	report.Check(checkRecord, fmt.Sprintf("created and deleted a TXT record at %s", name), testRecord(ctx, backend, config, zone, name))
+
+	delegated, err := internal.LookupNS(zone.Name, cfg.Nameservers, 0)
+	if err == nil {
+		err = internal.CheckDelegation(delegated, zone.Nameservers)
+	}
+	report.Check(checkDelegation, "delegated to "+strings.Join(delegated, ", "), err)
+
+	return report
+}
+
+// apiAccessError explains err listing the zones with config, hinting at a rejected token
+// or an API flavor not matching the API URL.
+func apiAccessError(config internal.Config, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var apiErr *internal.APIError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden):
+		return fmt.Errorf("token rejected by `%s` with %s", config.ApiUrl, apiErr.Status)
+	case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound,
+		errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		return fmt.Errorf("`%s` does not answer like the %s API, check apiUrl and apiFlavor; %v", config.ApiUrl, config.ApiFlavor, err)
+	}
+	return err
+}
+
+// findZone returns the zone name among zones, and an error when it cannot be used.
+func findZone(zones []internal.ZoneInfo, name string) (internal.ZoneInfo, error) {
+	for _, zone := range zones {
+		if internal.EqualDomain(zone.Name, name) {
+			return zone, zone.Usable()
+		}
+	}
+	return internal.ZoneInfo{Name: name}, &internal.ZoneNotFoundError{Domain: name}
+}
+
+// testRecord creates and deletes a TXT record with a random value at name in zone.
+func testRecord(ctx context.Context, backend dnsBackend, config internal.Config, zone internal.ZoneInfo, name string) error {
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return err
+	}
+	value := doctorValuePrefix + hex.EncodeToString(random)
+
+	record, err := backend.addTxtRecord(ctx, config, zone.Id, name, value, nil)
+	if err != nil {
+		return err
+	}
+	err = backend.deleteTxtRecord(ctx, config, internal.OwnedRecord{
+		ZoneId:   zone.Id,
+		ZoneName: zone.Name,
+		RecordId: record.Id,
+		Name:     name,
+		Value:    value,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to delete the test record, remove TXT value `%s` at `%s` manually; %v", value, name, err)
+	}
+	return nil
+}
+
+func zoneNames(zones []internal.ZoneInfo) string {
+	names := make([]string, len(zones))
+	for i, zone := range zones {
+		names[i] = zone.Name
+	}
+	return strings.Join(names, ", ")
+}
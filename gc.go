@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/trijpstra-fourlights/cert-manager-webhook-hetzner/internal"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+// gcOptions configures the sweeper deleting challenge records that were never cleaned up,
+// e.g. because the webhook crashed between Present and CleanUp.
+type gcOptions struct {
+	// Interval between two sweeps, zero disables the sweeper.
+	Interval time.Duration
+	// MaxAge after which a record created by the webhook is considered orphaned.
+	MaxAge time.Duration
+	// DryRun only logs the records that would be deleted.
+	DryRun bool
+}
+
+// gcZone identifies a zone together with the credentials used to reach it.
+type gcZone struct {
+	apiUrl, apiFlavor, zoneId              string
+	secretNamespace, secretName, secretKey string
+}
+
+// gcOptionsFromEnv reads the sweeper options from GC_INTERVAL, GC_MAX_AGE and GC_DRY_RUN.
+func gcOptionsFromEnv() (gcOptions, error) {
+	opts := gcOptions{Interval: time.Hour, MaxAge: 24 * time.Hour}
+
+	var err error
+	if v := os.Getenv("GC_INTERVAL"); v != "" {
+		if opts.Interval, err = time.ParseDuration(v); err != nil {
+			return opts, fmt.Errorf("invalid GC_INTERVAL `%s`; %v", v, err)
+		}
+	}
+	if v := os.Getenv("GC_MAX_AGE"); v != "" {
+		if opts.MaxAge, err = time.ParseDuration(v); err != nil {
+			return opts, fmt.Errorf("invalid GC_MAX_AGE `%s`; %v", v, err)
+		}
+	}
+	if v := os.Getenv("GC_DRY_RUN"); v != "" {
+		if opts.DryRun, err = strconv.ParseBool(v); err != nil {
+			return opts, fmt.Errorf("invalid GC_DRY_RUN `%s`; %v", v, err)
+		}
+	}
+
+	return opts, nil
+}
+
+// runGarbageCollector sweeps orphaned records every opts.Interval until stopCh is closed.
+func (c *hetznerDNSProviderSolver) runGarbageCollector(opts gcOptions, stopCh <-chan struct{}) {
+	logger := internal.NewLogger().WithName("gc")
+	logger.Info("Starting garbage collector", "interval", opts.Interval, "maxAge", opts.MaxAge, "dryRun", opts.DryRun)
+	wait.Until(func() {
+		if _, err := c.collectGarbage(klog.NewContext(context.TODO(), logger), opts); err != nil {
+			logger.Error(err, "Garbage collection failed")
+		}
+	}, opts.Interval, stopCh)
+}
+
+// gcSummary counts the orphaned records of a sweep. In a dry run, deleted and forgotten
+// count the records that would be deleted or forgotten.
+type gcSummary struct {
+	// deleted orphans existed in their zone, forgotten ones were already gone and only
+	// their ownership entry is removed.
+	deleted, forgotten int
+	unowned, failed    int
+}
+
+// collectGarbage deletes the records tracked in the ownership store that are older than
+// opts.MaxAge, zone by zone.
+func (c *hetznerDNSProviderSolver) collectGarbage(ctx context.Context, opts gcOptions) (gcSummary, error) {
+	logger := klog.FromContext(ctx)
+	var summary gcSummary
+	entries, err := c.ownership.List(ctx)
+	if err != nil {
+		return summary, err
+	}
+
+	zones := map[gcZone][]internal.OwnedEntry{}
+	for _, entry := range entries {
+		zone := gcZone{
+			apiUrl:          entry.ApiUrl,
+			apiFlavor:       entry.ApiFlavor,
+			zoneId:          entry.ZoneId,
+			secretNamespace: entry.SecretNamespace,
+			secretName:      entry.SecretName,
+			secretKey:       entry.SecretKey,
+		}
+		zones[zone] = append(zones[zone], entry)
+	}
+
+	cutoff := time.Now().Add(-opts.MaxAge)
+	for zone, owned := range zones {
+		config := internal.Config{ApiUrl: zone.apiUrl, ApiFlavor: zone.apiFlavor}
+		config.ApiKey, err = c.secretValue(ctx, zone.secretNamespace, zone.secretName, zone.secretKey)
+		if err != nil {
+			logger.Error(err, "Skipping zone in garbage collection", "zoneID", zone.zoneId)
+			summary.failed += len(owned)
+			continue
+		}
+
+		backend := backendFor(config)
+		records, err := backend.txtRecords(ctx, config, zone.zoneId)
+		if err != nil {
+			logger.Error(err, "Skipping zone in garbage collection", "zoneID", zone.zoneId)
+			summary.failed += len(owned)
+			continue
+		}
+
+		orphans, unownedRecords := internal.FindOrphans(owned, records, c.clusterID, cutoff)
+		summary.unowned += len(unownedRecords)
+		for _, orphan := range orphans {
+			if opts.DryRun {
+				if orphan.Exists {
+					logger.Info("Dry run, would delete orphaned TXT record", "record", orphan.RecordId, "name", orphan.Name,
+						"zone", orphan.ZoneName, "created", orphan.Created.Format(time.RFC3339))
+					summary.deleted++
+				} else {
+					logger.Info("Dry run, would forget TXT record already gone from its zone", "record", orphan.RecordId,
+						"name", orphan.Name, "zone", orphan.ZoneName)
+					summary.forgotten++
+				}
+				continue
+			}
+
+			if orphan.Exists {
+				// A challenge for the same name may be changing the record concurrently
+				unlock, err := c.lockOwnedRecord(ctx, orphan.OwnedRecord)
+				if err != nil {
+					logger.Error(err, "Skipping orphaned TXT record, unable to lock it", "record", orphan.RecordId)
+					summary.failed++
+					continue
+				}
+				err = backend.deleteTxtRecord(ctx, config, orphan.OwnedRecord)
+				unlock()
+				c.auditChange(ctx, internal.AuditDelete, "gc", orphan.OwnedRecord, nil, err)
+				if err != nil {
+					logger.Error(err, "Unable to delete orphaned TXT record", "record", orphan.RecordId)
+					summary.failed++
+					continue
+				}
+				logger.Info("Deleted orphaned TXT record", "record", orphan.RecordId, "name", orphan.Name, "zone", orphan.ZoneName)
+				summary.deleted++
+			} else {
+				summary.forgotten++
+			}
+
+			if err := c.ownership.Remove(ctx, orphan.Key, orphan.RecordId); err != nil {
+				logger.Error(err, "Unable to remove ownership of TXT record", "record", orphan.RecordId)
+			}
+		}
+	}
+
+	if opts.DryRun {
+		logger.Info("Garbage collection dry run finished", "wouldDelete", summary.deleted, "wouldForget", summary.forgotten,
+			"failed", summary.failed, "unowned", summary.unowned)
+	} else {
+		logger.Info("Garbage collection finished", "deleted", summary.deleted, "forgotten", summary.forgotten,
+			"failed", summary.failed, "unowned", summary.unowned)
+	}
+
+	return summary, nil
+}
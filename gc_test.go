@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/trijpstra-fourlights/cert-manager-webhook-hetzner/internal"
+	"github.com/trijpstra-fourlights/cert-manager-webhook-hetzner/internal/hetznertest"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+// gcSolver returns a solver owning an orphaned record of example.com that still exists,
+// and one that is already gone.
+func gcSolver(t *testing.T) (*hetznerDNSProviderSolver, *hetznertest.Server) {
+	t.Helper()
+
+	fake := hetznertest.NewServer(t, fakeToken)
+	zoneId := fake.AddZone(hetznertest.Zone{Name: "example.com"})
+	fake.AddRecord("example.com", "_acme-challenge.www", "TXT", `"key1"`)
+
+	solver := &hetznerDNSProviderSolver{
+		apiToken:  fakeToken,
+		ownership: internal.NewOwnershipStore(k8sfake.NewSimpleClientset(), "default", "ownership"),
+	}
+	created := time.Now().Add(-48 * time.Hour)
+	for key, recordId := range map[string]string{"existing": fake.Records("example.com")[0].Id, "gone": "gone"} {
+		err := solver.ownership.Add(context.Background(), key, internal.OwnedRecord{
+			ZoneId:    zoneId,
+			ZoneName:  "example.com",
+			RecordId:  recordId,
+			Name:      "_acme-challenge.www",
+			Value:     "key1",
+			Created:   created,
+			ApiUrl:    fake.URL(internal.ApiFlavorLegacy),
+			ApiFlavor: internal.ApiFlavorLegacy,
+		})
+		if err != nil {
+			t.Fatalf("Expected no error, but got: %v", err)
+		}
+	}
+
+	return solver, fake
+}
+
+func TestCollectGarbage(t *testing.T) {
+	testCases := []struct {
+		name            string
+		dryRun          bool
+		expectedTxt     []string
+		expectedEntries int
+	}{
+		{"dry run", true, []string{"key1"}, 2},
+		{"live", false, nil, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			solver, fake := gcSolver(t)
+
+			summary, err := solver.collectGarbage(context.Background(), gcOptions{MaxAge: 24 * time.Hour, DryRun: tc.dryRun})
+			if err != nil {
+				t.Fatalf("Expected no error, but got: %v", err)
+			}
+			if expected := (gcSummary{deleted: 1, forgotten: 1}); summary != expected {
+				t.Errorf("Expected %+v, but got %+v", expected, summary)
+			}
+			if values := fake.TXT("example.com", "_acme-challenge.www"); !reflect.DeepEqual(values, tc.expectedTxt) {
+				t.Errorf("Expected %v, but got %v", tc.expectedTxt, values)
+			}
+			entries, _ := solver.ownership.List(context.Background())
+			if len(entries) != tc.expectedEntries {
+				t.Errorf("Expected %d ownership entries, but got %d", tc.expectedEntries, len(entries))
+			}
+		})
+	}
+}
+
+func TestCollectGarbageSkipsLockedRecord(t *testing.T) {
+	solver, fake := gcSolver(t)
+	client := k8sfake.NewSimpleClientset()
+	solver.recordLeases = internal.NewLeaseLocker(client, "default", "gc-replica", time.Second)
+	solver.recordLeaseDuration = time.Second
+
+	// A challenge for the same record is in progress on another replica
+	unlock, err := internal.NewLeaseLocker(client, "default", "other-replica", time.Minute).
+		Lock(context.Background(), "example.com/_acme-challenge.www.example.com")
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	defer unlock()
+
+	summary, err := solver.collectGarbage(context.Background(), gcOptions{MaxAge: 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	if expected := (gcSummary{forgotten: 1, failed: 1}); summary != expected {
+		t.Errorf("Expected %+v, but got %+v", expected, summary)
+	}
+	if values := fake.TXT("example.com", "_acme-challenge.www"); !reflect.DeepEqual(values, []string{"key1"}) {
+		t.Errorf("Expected the locked record to be kept, but got %v", values)
+	}
+	if leases, _ := client.CoordinationV1().Leases("default").List(context.Background(), metav1.ListOptions{}); len(leases.Items) != 1 {
+		t.Errorf("Expected only the lease of the other replica, but got %d", len(leases.Items))
+	}
+}
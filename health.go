@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/trijpstra-fourlights/cert-manager-webhook-hetzner/internal"
+	"k8s.io/klog/v2"
+)
+
+// healthOptions configures the readiness check of the Hetzner APIs.
+type healthOptions struct {
+	// Interval between two checks of all endpoints.
+	Interval time.Duration
+	// ApiUrls are the checked endpoints. Without any, readiness only depends on the
+	// webhook server.
+	ApiUrls []string
+	// Secret and SecretKey reference a token in the webhook's namespace that is checked
+	// against ApiUrls, if set.
+	Secret    string
+	SecretKey string
+}
+
+// healthOptionsFromEnv reads the health check options from HEALTH_CHECK_INTERVAL,
+// HEALTH_CHECK_API_URLS, HEALTH_CHECK_SECRET and HEALTH_CHECK_SECRET_KEY.
+func healthOptionsFromEnv() (healthOptions, error) {
+	opts := healthOptions{
+		Interval:  time.Minute,
+		Secret:    os.Getenv("HEALTH_CHECK_SECRET"),
+		SecretKey: os.Getenv("HEALTH_CHECK_SECRET_KEY"),
+	}
+	if opts.SecretKey == "" {
+		opts.SecretKey = "api-key"
+	}
+
+	if v := os.Getenv("HEALTH_CHECK_INTERVAL"); v != "" {
+		var err error
+		if opts.Interval, err = time.ParseDuration(v); err != nil {
+			return opts, fmt.Errorf("invalid HEALTH_CHECK_INTERVAL `%s`; %v", v, err)
+		}
+		if opts.Interval <= 0 {
+			return opts, fmt.Errorf("HEALTH_CHECK_INTERVAL must be positive, got `%s`", opts.Interval)
+		}
+	}
+	for _, url := range strings.Split(os.Getenv("HEALTH_CHECK_API_URLS"), ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			opts.ApiUrls = append(opts.ApiUrls, url)
+		}
+	}
+
+	return opts, nil
+}
+
+// startHealthChecks adds the endpoints of opts to the health checks and runs them until
+// stopCh is closed.
+func (c *hetznerDNSProviderSolver) startHealthChecks(opts healthOptions, stopCh <-chan struct{}) error {
+	if len(opts.ApiUrls) == 0 {
+		return nil
+	}
+	token := ""
+	if opts.Secret != "" {
+		var err error
+		token, err = c.secretValue(context.TODO(), webhookNamespace(), opts.Secret, opts.SecretKey)
+		if err != nil {
+			return fmt.Errorf("unable to read health check token; %v", err)
+		}
+	}
+	for _, url := range opts.ApiUrls {
+		c.health.AddEndpoint(url, token)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+	go c.health.Run(klog.NewContext(ctx, internal.NewLogger().WithName("health")), opts.Interval)
+
+	return nil
+}
+
+// serveHealth serves the readiness check of the webhook server, answering at
+// webhookHealthz, and of health on address until ctx is done.
+func serveHealth(ctx context.Context, address string, health *internal.APIHealth, webhookHealthz string) {
+	mux := http.NewServeMux()
+	mux.Handle("/readyz", readyz(health, webhookHealthz))
+	mux.HandleFunc("/livez", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})
+
+	serveHTTP(ctx, "health", address, mux)
+}
+
+// readyz answers readiness probes once the webhook server answers webhookHealthz and the
+// configured Hetzner API endpoints are available.
+func readyz(health *internal.APIHealth, webhookHealthz string) http.Handler {
+	// The webhook serves a certificate for its service name, not for the loopback address
+	client := &http.Client{
+		Timeout:   healthCheckTimeout,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}, //nolint:gosec // only asked on the loopback address
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, webhookHealthz, nil)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("webhook server unreachable; %v", err), http.StatusServiceUnavailable)
+			return
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			http.Error(w, "webhook server answered "+resp.Status, http.StatusServiceUnavailable)
+			return
+		}
+
+		health.ServeHTTP(w, r)
+	})
+}
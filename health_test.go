@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/trijpstra-fourlights/cert-manager-webhook-hetzner/internal"
+)
+
+func TestHealthOptionsFromEnv(t *testing.T) {
+	t.Setenv("HEALTH_CHECK_API_URLS", "")
+	opts, err := healthOptionsFromEnv()
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	if len(opts.ApiUrls) != 0 {
+		t.Errorf("Expected no endpoints by default, but got %v", opts.ApiUrls)
+	}
+
+	t.Setenv("HEALTH_CHECK_API_URLS", "https://api.hetzner.cloud/v1, https://dns.hetzner.com/api/v1")
+	if opts, _ = healthOptionsFromEnv(); len(opts.ApiUrls) != 2 {
+		t.Errorf("Expected 2 endpoints, but got %v", opts.ApiUrls)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	webhookStatus := http.StatusOK
+	webhook := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(webhookStatus)
+	}))
+	defer webhook.Close()
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer api.Close()
+
+	testCases := []struct {
+		name          string
+		webhookStatus int
+		apiUrl        string
+		expected      int
+	}{
+		{"healthy without endpoints", http.StatusOK, "", http.StatusOK},
+		{"unhealthy webhook", http.StatusInternalServerError, "", http.StatusServiceUnavailable},
+		{"unavailable endpoint", http.StatusOK, api.URL, http.StatusServiceUnavailable},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			webhookStatus = tc.webhookStatus
+			health := internal.NewAPIHealth(time.Second)
+			health.AddEndpoint(tc.apiUrl, "")
+			health.CheckAll(context.Background())
+
+			recorder := httptest.NewRecorder()
+			readyz(health, webhook.URL+"/healthz").ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if recorder.Code != tc.expected {
+				t.Errorf("Expected status %d, but got %d", tc.expected, recorder.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+// Operations and results of audit events.
+const (
+	AuditCreate  = "create"
+	AuditDelete  = "delete"
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+// AuditEvent describes a change of a DNS record attempted by the webhook.
+type AuditEvent struct {
+	Time      time.Time `json:"timestamp"`
+	Operation string    `json:"operation"`
+	// Source is the part of the webhook making the change: present, cleanup, gc or
+	// deletion-queue.
+	Source    string `json:"source"`
+	Zone      string `json:"zone"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	ValueHash string `json:"valueHash"`
+	RecordId  string `json:"recordId,omitempty"`
+	// Namespace and ChallengeUID identify the Challenge requesting the change. They are only
+	// set when the Challenge resource could be found, never for garbage collection and
+	// deletion retries.
+	Namespace    string `json:"namespace,omitempty"`
+	ChallengeUID string `json:"challengeUID,omitempty"`
+	Result       string `json:"result"`
+	Error        string `json:"error,omitempty"`
+}
+
+// AuditValueHash returns the hash of a record value stored in audit events instead of the
+// value itself.
+func AuditValueHash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// AuditSink stores audit events.
+type AuditSink interface {
+	Write(ctx context.Context, event AuditEvent) error
+}
+
+// AuditLog records DNS changes to its sinks. A nil log records nothing.
+type AuditLog struct {
+	sinks []AuditSink
+	now   func() time.Time
+}
+
+func NewAuditLog(sinks ...AuditSink) *AuditLog {
+	return &AuditLog{sinks: sinks, now: time.Now}
+}
+
+// Record completes event with the time and the result of err, and writes it to all sinks.
+// Failing sinks are logged, they never fail the change itself.
+func (a *AuditLog) Record(ctx context.Context, event AuditEvent, err error) {
+	if a == nil {
+		return
+	}
+
+	event.Time = a.now().UTC()
+	event.Result = AuditSuccess
+	if err != nil {
+		event.Result = AuditFailure
+		event.Error = Redact(err.Error())
+	}
+
+	for _, sink := range a.sinks {
+		if err := sink.Write(ctx, event); err != nil {
+			klog.FromContext(ctx).Error(err, "Unable to write audit event", "operation", event.Operation, "zone", event.Zone, "name", event.Name)
+		}
+	}
+}
+
+// JSONLinesAuditSink appends every event to a writer as a line of JSON.
+type JSONLinesAuditSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewJSONLinesAuditSink(w io.Writer) *JSONLinesAuditSink {
+	return &JSONLinesAuditSink{w: w}
+}
+
+func (s *JSONLinesAuditSink) Write(_ context.Context, event AuditEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("unable to marshal audit event; %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(line, '\n'))
+	return err
+}
+
+// ConfigMapAuditSink keeps the latest events in a ConfigMap, keyed by time, so that they
+// can be inspected with kubectl. The oldest events are dropped beyond maxEntries, as
+// ConfigMaps are limited in size.
+type ConfigMapAuditSink struct {
+	store      configMapStore
+	maxEntries int
+}
+
+func NewConfigMapAuditSink(client kubernetes.Interface, namespace, name string, maxEntries int) *ConfigMapAuditSink {
+	return &ConfigMapAuditSink{store: configMapStore{client: client, namespace: namespace, name: name}, maxEntries: maxEntries}
+}
+
+func (s *ConfigMapAuditSink) Write(ctx context.Context, event AuditEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("unable to marshal audit event; %v", err)
+	}
+	// Keys sort by time; the hash keeps events of the same instant apart
+	sum := sha256.Sum256(line)
+	key := event.Time.UTC().Format("20060102T150405.000000000Z") + "-" + hex.EncodeToString(sum[:4])
+
+	return s.store.update(ctx, func(data map[string]string) error {
+		data[key] = string(line)
+		if len(data) <= s.maxEntries {
+			return nil
+		}
+
+		keys := make([]string, 0, len(data))
+		for k := range data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys[:len(keys)-s.maxEntries] {
+			delete(data, k)
+		}
+		return nil
+	})
+}
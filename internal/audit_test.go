@@ -0,0 +1,88 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestAuditLog(t *testing.T) {
+	ctx := context.Background()
+	var buf bytes.Buffer
+	audit := NewAuditLog(NewJSONLinesAuditSink(&buf))
+	audit.now = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }
+
+	event := AuditEvent{
+		Operation:    AuditCreate,
+		Source:       "present",
+		Zone:         "example.com",
+		Name:         "_acme-challenge",
+		Type:         "TXT",
+		ValueHash:    AuditValueHash("key1"),
+		RecordId:     "record1",
+		Namespace:    "default",
+		ChallengeUID: "uid-1",
+	}
+	audit.Record(ctx, event, nil)
+	RegisterSecret(testToken)
+	audit.Record(ctx, event, errors.New("unauthorized: "+testToken))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, but got %d: %s", len(lines), buf.String())
+	}
+
+	var first, second AuditEvent
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatalf("Expected a JSON line, but got %s: %v", lines[0], err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &second); err != nil {
+		t.Fatalf("Expected a JSON line, but got %s: %v", lines[1], err)
+	}
+	if first.Result != AuditSuccess || first.Error != "" || !first.Time.Equal(audit.now()) {
+		t.Errorf("Unexpected successful event %+v", first)
+	}
+	if second.Result != AuditFailure || second.Error != "unauthorized: [REDACTED]" {
+		t.Errorf("Unexpected failed event %+v", second)
+	}
+	if strings.Contains(buf.String(), "key1") {
+		t.Errorf("Expected the record value to be hashed, but got %s", buf.String())
+	}
+
+	var nilAudit *AuditLog
+	nilAudit.Record(ctx, event, nil)
+}
+
+func TestConfigMapAuditSink(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+	sink := NewConfigMapAuditSink(client, "cert-manager", "audit", 2)
+
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i, name := range []string{"first", "second", "third"} {
+		event := AuditEvent{Time: start.Add(time.Duration(i) * time.Second), Operation: AuditDelete, Name: name, Result: AuditSuccess}
+		if err := sink.Write(ctx, event); err != nil {
+			t.Fatalf("Expected no error, but got: %v", err)
+		}
+	}
+
+	cm, err := client.CoreV1().ConfigMaps("cert-manager").Get(ctx, "audit", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Expected the ConfigMap to exist, but got: %v", err)
+	}
+	if len(cm.Data) != 2 {
+		t.Fatalf("Expected 2 entries, but got %d", len(cm.Data))
+	}
+	for _, line := range cm.Data {
+		if strings.Contains(line, `"name":"first"`) {
+			t.Errorf("Expected the oldest event to be dropped, but got %s", line)
+		}
+	}
+}
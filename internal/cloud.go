@@ -0,0 +1,208 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	// ApiFlavorLegacy is the DNS API of dns.hetzner.com, storing one record per value.
+	ApiFlavorLegacy = "legacy"
+	// ApiFlavorCloud is the DNS API of the Hetzner Cloud, storing the values of a name and
+	// type in a single rrset.
+	ApiFlavorCloud = "cloud"
+
+	cloudApiHost = "api.hetzner.cloud"
+)
+
+// ApiFlavor returns the API spoken at apiUrl: flavor when it is set, otherwise the Cloud API
+// for api.hetzner.cloud and the legacy DNS API for any other host.
+func ApiFlavor(flavor, apiUrl string) string {
+	if flavor != "" {
+		return flavor
+	}
+	if u, err := url.Parse(apiUrl); err == nil && strings.EqualFold(u.Hostname(), cloudApiHost) {
+		return ApiFlavorCloud
+	}
+	return ApiFlavorLegacy
+}
+
+type CloudZoneResponse struct {
+	Zones []CloudZone `json:"zones"`
+	Meta  Meta        `json:"meta"`
+}
+
+type CloudZone struct {
+	Id   int64  `json:"id"`
+	Name string `json:"name"`
+	// Mode is primary, or secondary for zones transferred from another nameserver.
+	Mode                     string                        `json:"mode"`
+	Status                   string                        `json:"status"`
+	AuthoritativeNameservers CloudAuthoritativeNameservers `json:"authoritative_nameservers"`
+}
+
+type CloudAuthoritativeNameservers struct {
+	Assigned         []string `json:"assigned"`
+	Delegated        []string `json:"delegated"`
+	DelegationStatus string   `json:"delegation_status"`
+}
+
+// Info returns the description of the zone shared by both APIs.
+func (z CloudZone) Info() ZoneInfo {
+	return ZoneInfo{
+		Id:          strconv.FormatInt(z.Id, 10),
+		Name:        z.Name,
+		Status:      z.Status,
+		Secondary:   z.Mode == "secondary",
+		Nameservers: z.AuthoritativeNameservers.Assigned,
+	}
+}
+
+type CloudRRSetResponse struct {
+	RRSet CloudRRSet `json:"rrset"`
+}
+
+type CloudRRSetsResponse struct {
+	RRSets []CloudRRSet `json:"rrsets"`
+	Meta   Meta         `json:"meta"`
+}
+
+type CloudRRSet struct {
+	Id      string            `json:"id,omitempty"`
+	Name    string            `json:"name"`
+	Type    string            `json:"type"`
+	Ttl     int               `json:"ttl,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	Records []CloudRecord     `json:"records"`
+	Zone    int64             `json:"zone,omitempty"`
+}
+
+type CloudRecord struct {
+	Value   string `json:"value"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// CloudRecordsRequest is the body of the add_records and remove_records rrset actions.
+type CloudRecordsRequest struct {
+	Ttl     int           `json:"ttl,omitempty"`
+	Records []CloudRecord `json:"records"`
+}
+
+// CloudActionResponse is the part of Cloud API responses describing the asynchronous
+// action started by a mutation.
+type CloudActionResponse struct {
+	Action *CloudAction `json:"action"`
+}
+
+const (
+	ActionStatusRunning = "running"
+	ActionStatusSuccess = "success"
+	ActionStatusError   = "error"
+)
+
+type CloudAction struct {
+	Id      int64             `json:"id"`
+	Command string            `json:"command"`
+	Status  string            `json:"status"`
+	Error   *CloudActionError `json:"error"`
+}
+
+type CloudActionError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ActionError is returned for Cloud API actions that finished with an error.
+type ActionError struct {
+	Id      int64
+	Command string
+	Code    string
+	Message string
+}
+
+func (e *ActionError) Error() string {
+	return fmt.Sprintf("action %d (%s) failed: %s: %s", e.Id, e.Command, e.Code, e.Message)
+}
+
+// ActionGetter returns the current state of the action with the given id.
+type ActionGetter func(id int64) (CloudAction, error)
+
+// WaitForAction polls action with get every interval until it succeeds or fails, returning
+// an ActionError for failed actions. It gives up when ctx is done.
+func WaitForAction(ctx context.Context, action CloudAction, get ActionGetter, interval time.Duration) error {
+	for {
+		switch action.Status {
+		case ActionStatusSuccess:
+			return nil
+		case ActionStatusError:
+			actionErr := &ActionError{Id: action.Id, Command: action.Command}
+			if action.Error != nil {
+				actionErr.Code, actionErr.Message = action.Error.Code, action.Error.Message
+			}
+			return actionErr
+		}
+		klog.FromContext(ctx).V(4).Info("Waiting for action", "action", action.Id, "command", action.Command, "status", action.Status)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("action %d (%s) did not complete; %v", action.Id, action.Command, ctx.Err())
+		case <-time.After(interval):
+		}
+
+		current, err := get(action.Id)
+		if err != nil {
+			return fmt.Errorf("unable to get action %d (%s); %v", action.Id, action.Command, err)
+		}
+		action = current
+	}
+}
+
+// FindValue returns the record of the rrset holding the TXT value, in the presentation
+// form stored by the API.
+func (r CloudRRSet) FindValue(value string) (CloudRecord, bool) {
+	for _, record := range r.Records {
+		if DecodeTxt(record.Value) == value {
+			return record, true
+		}
+	}
+	return CloudRecord{}, false
+}
+
+// CloudRecordId returns the id under which the TXT value of the rrset name in zoneId is
+// tracked. The Cloud API has no ids for single values, so the id is derived from them; it
+// is a valid ConfigMap key.
+func CloudRecordId(zoneId, name, value string) string {
+	sum := sha256.Sum256([]byte(zoneId + "/" + name + "/TXT/" + value))
+	return "rrset-" + hex.EncodeToString(sum[:16])
+}
+
+// CloudRecords flattens the TXT rrsets of zoneId into one Record per value, as listed by
+// the legacy API.
+func CloudRecords(zoneId string, rrsets []CloudRRSet) []Record {
+	var records []Record
+	for _, rrset := range rrsets {
+		if rrset.Type != "TXT" {
+			continue
+		}
+		for _, record := range rrset.Records {
+			value := DecodeTxt(record.Value)
+			records = append(records, Record{
+				Type:   rrset.Type,
+				Id:     CloudRecordId(zoneId, rrset.Name, value),
+				ZoneId: zoneId,
+				Name:   rrset.Name,
+				Value:  value,
+				Ttl:    rrset.Ttl,
+			})
+		}
+	}
+	return records
+}
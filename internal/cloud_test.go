@@ -0,0 +1,125 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApiFlavor(t *testing.T) {
+	testCases := []struct {
+		flavor, apiUrl string
+		expected       string
+	}{
+		{"", "https://api.hetzner.cloud/v1", ApiFlavorCloud},
+		{"", "https://API.hetzner.cloud:443/v1", ApiFlavorCloud},
+		{"", "https://dns.hetzner.com/api/v1", ApiFlavorLegacy},
+		{"", "http://localhost:8080", ApiFlavorLegacy},
+		{ApiFlavorCloud, "http://localhost:8080", ApiFlavorCloud},
+		{ApiFlavorLegacy, "https://api.hetzner.cloud/v1", ApiFlavorLegacy},
+	}
+
+	for _, tc := range testCases {
+		if flavor := ApiFlavor(tc.flavor, tc.apiUrl); flavor != tc.expected {
+			t.Errorf("Expected flavor %s for %q and %q, but got %s", tc.expected, tc.flavor, tc.apiUrl, flavor)
+		}
+	}
+}
+
+func TestCloudRecords(t *testing.T) {
+	rrsets := []CloudRRSet{
+		{Name: "_acme-challenge", Type: "TXT", Ttl: 120, Records: []CloudRecord{{Value: `"first"`}, {Value: `"second"`}}},
+		{Name: "www", Type: "A", Records: []CloudRecord{{Value: "192.0.2.1"}}},
+		{Name: "@", Type: "TXT", Records: []CloudRecord{{Value: "unquoted"}}},
+	}
+
+	records := CloudRecords("42", rrsets)
+
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 TXT records, but got %v", records)
+	}
+	if records[0].Value != "first" || records[1].Value != "second" || records[2].Value != "unquoted" {
+		t.Errorf("Expected unquoted values, but got %v", records)
+	}
+	if records[0].Id != CloudRecordId("42", "_acme-challenge", "first") || records[0].Id == records[1].Id {
+		t.Errorf("Expected a distinct id per value, but got %v", records)
+	}
+	if records[0].ZoneId != "42" || records[0].Name != "_acme-challenge" || records[0].Ttl != 120 {
+		t.Errorf("Expected zone, name and ttl of the rrset, but got %+v", records[0])
+	}
+}
+
+func TestCloudRecordId(t *testing.T) {
+	configMapKey := regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+
+	id := CloudRecordId("42", "@", "value/with+special=chars")
+	if !configMapKey.MatchString(id) {
+		t.Errorf("Expected a valid ConfigMap key, but got %s", id)
+	}
+	if id != CloudRecordId("42", "@", "value/with+special=chars") {
+		t.Error("Expected the id to be stable")
+	}
+	if id == CloudRecordId("43", "@", "value/with+special=chars") {
+		t.Error("Expected the id to depend on the zone")
+	}
+}
+
+func TestCloudRRSetFindValue(t *testing.T) {
+	long := strings.Repeat("a", 300)
+	rrset := CloudRRSet{Records: []CloudRecord{{Value: `"key"`}, {Value: EncodeTxt(long)}}}
+
+	if record, ok := rrset.FindValue("key"); !ok || record.Value != `"key"` {
+		t.Errorf("Expected the quoted value to be found as stored, but got %v", record)
+	}
+	if _, ok := rrset.FindValue(long); !ok {
+		t.Error("Expected the chunked value to be found")
+	}
+	if _, ok := rrset.FindValue("other"); ok {
+		t.Error("Expected other values not to be found")
+	}
+}
+
+func TestWaitForAction(t *testing.T) {
+	running := CloudAction{Id: 1, Command: "add_rrset_records", Status: ActionStatusRunning}
+
+	polls := 0
+	err := WaitForAction(context.Background(), running, func(id int64) (CloudAction, error) {
+		polls++
+		if polls < 3 {
+			return running, nil
+		}
+		return CloudAction{Id: id, Command: running.Command, Status: ActionStatusSuccess}, nil
+	}, time.Millisecond)
+	if err != nil || polls != 3 {
+		t.Errorf("Expected success after 3 polls, but got %v after %d", err, polls)
+	}
+
+	err = WaitForAction(context.Background(), running, func(id int64) (CloudAction, error) {
+		return CloudAction{Id: id, Command: running.Command, Status: ActionStatusError,
+			Error: &CloudActionError{Code: "invalid_input", Message: "invalid TXT value"}}, nil
+	}, time.Millisecond)
+	var actionErr *ActionError
+	if !errors.As(err, &actionErr) || actionErr.Code != "invalid_input" || actionErr.Message != "invalid TXT value" {
+		t.Errorf("Expected an ActionError with code and message, but got %v", err)
+	}
+
+	err = WaitForAction(context.Background(), CloudAction{Id: 2, Status: ActionStatusSuccess}, func(int64) (CloudAction, error) {
+		t.Error("Expected a finished action not to be polled")
+		return CloudAction{}, nil
+	}, time.Millisecond)
+	if err != nil {
+		t.Errorf("Expected no error, but got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err = WaitForAction(ctx, running, func(int64) (CloudAction, error) {
+		return running, nil
+	}, time.Millisecond)
+	if err == nil {
+		t.Error("Expected an error for an action that never completes")
+	}
+}
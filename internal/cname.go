@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"k8s.io/klog/v2"
+)
+
+const (
+	defaultMaxCNAMEHops = 8
+	defaultDNSTimeout   = 5 * time.Second
+)
+
+// CNAMEResolver follows the CNAME chain of a name, e.g. an _acme-challenge record that is
+// delegated into another zone, by querying the given recursive nameservers.
+type CNAMEResolver struct {
+	// Nameservers are queried in order until one of them answers, as host:port where
+	// the port defaults to 53. When empty the nameservers from /etc/resolv.conf are used.
+	Nameservers []string
+	// MaxHops bounds the length of the chain, defaults to 8.
+	MaxHops int
+	// Timeout for a single query, defaults to 5 seconds.
+	Timeout time.Duration
+}
+
+// Follow returns the final target of the CNAME chain starting at fqdn as a fully
+// qualified name, or fqdn itself when it is not a CNAME. Loops and chains longer than
+// MaxHops result in an error.
+func (r *CNAMEResolver) Follow(fqdn string) (string, error) {
+	nameservers, err := resolverAddresses(r.Nameservers)
+	if err != nil {
+		return "", err
+	}
+
+	maxHops := r.MaxHops
+	if maxHops <= 0 {
+		maxHops = defaultMaxCNAMEHops
+	}
+
+	name := dns.Fqdn(strings.ToLower(fqdn))
+	visited := map[string]bool{name: true}
+	for hop := 0; hop < maxHops; hop++ {
+		target, err := r.lookupCNAME(name, nameservers)
+		if err != nil {
+			return "", err
+		}
+		if target == "" {
+			return name, nil
+		}
+
+		klog.V(4).InfoS("Following CNAME", "name", name, "target", target)
+		if visited[target] {
+			return "", fmt.Errorf("CNAME loop detected at '%s' while following '%s'", target, fqdn)
+		}
+		visited[target] = true
+		name = target
+	}
+
+	return "", fmt.Errorf("CNAME chain of '%s' exceeds %d hops", fqdn, maxHops)
+}
+
+// resolverAddresses returns nameservers as host:port, or the nameservers from
+// /etc/resolv.conf when none are given.
+func resolverAddresses(nameservers []string) ([]string, error) {
+	var addresses []string
+	for _, nameserver := range nameservers {
+		if _, _, err := net.SplitHostPort(nameserver); err != nil {
+			nameserver = net.JoinHostPort(nameserver, "53")
+		}
+		addresses = append(addresses, nameserver)
+	}
+	if len(addresses) == 0 {
+		conf, err := dns.ClientConfigFromFile("/etc/resolv.conf")
+		if err != nil {
+			return nil, fmt.Errorf("unable to read nameservers: %v", err)
+		}
+		for _, server := range conf.Servers {
+			addresses = append(addresses, net.JoinHostPort(server, conf.Port))
+		}
+	}
+	if len(addresses) == 0 {
+		return nil, errors.New("no nameservers configured")
+	}
+	return addresses, nil
+}
+
+// lookupCNAME returns the lowercase CNAME target of name, or an empty string when name
+// has no CNAME record.
+func (r *CNAMEResolver) lookupCNAME(name string, nameservers []string) (string, error) {
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = defaultDNSTimeout
+	}
+	client := &dns.Client{Timeout: timeout}
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(name, dns.TypeCNAME)
+
+	var errs []error
+	for _, nameserver := range nameservers {
+		in, _, err := client.Exchange(msg, nameserver)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", nameserver, err))
+			continue
+		}
+
+		switch in.Rcode {
+		case dns.RcodeSuccess, dns.RcodeNameError:
+		default:
+			errs = append(errs, fmt.Errorf("%s: unexpected response code %s", nameserver, dns.RcodeToString[in.Rcode]))
+			continue
+		}
+
+		for _, rr := range in.Answer {
+			if cname, ok := rr.(*dns.CNAME); ok && strings.EqualFold(cname.Hdr.Name, name) {
+				return strings.ToLower(cname.Target), nil
+			}
+		}
+		return "", nil
+	}
+
+	return "", fmt.Errorf("unable to resolve CNAME for '%s': %v", name, errors.Join(errs...))
+}
@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// startDNSServer serves the given CNAME records (name -> target) on a local UDP port and
+// returns its address.
+func startDNSServer(t *testing.T, cnames map[string]string) string {
+	t.Helper()
+
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		msg := new(dns.Msg)
+		msg.SetReply(r)
+
+		name := r.Question[0].Name
+		if target, ok := cnames[name]; ok {
+			msg.Answer = append(msg.Answer, &dns.CNAME{
+				Hdr:    dns.RR_Header{Name: name, Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: 60},
+				Target: target,
+			})
+		} else {
+			msg.Rcode = dns.RcodeNameError
+		}
+		_ = w.WriteMsg(msg)
+	})
+
+	started := make(chan struct{})
+	server := &dns.Server{Addr: "127.0.0.1:0", Net: "udp", Handler: handler, NotifyStartedFunc: func() { close(started) }}
+	go func() {
+		_ = server.ListenAndServe()
+	}()
+	<-started
+	t.Cleanup(func() {
+		_ = server.Shutdown()
+	})
+
+	return server.PacketConn.LocalAddr().String()
+}
+
+func TestCNAMEResolverFollow(t *testing.T) {
+	nameserver := startDNSServer(t, map[string]string{
+		"_acme-challenge.customer.com.":   "_acme-challenge.customer.com.validation.net.",
+		"_acme-challenge.two-hops.com.":   "_acme-challenge.customer.com.",
+		"_acme-challenge.loop-a.com.":     "_acme-challenge.loop-b.com.",
+		"_acme-challenge.loop-b.com.":     "_acme-challenge.loop-a.com.",
+		"_acme-challenge.uppercase.com.":  "_ACME-challenge.Validation.NET.",
+		"_acme-challenge.long-chain.com.": "_acme-challenge.two-hops.com.",
+	})
+
+	testCases := []struct {
+		name           string
+		fqdn           string
+		maxHops        int
+		expected       string
+		expectedErrMsg string
+	}{
+		{
+			name:     "No CNAME returns the name itself",
+			fqdn:     "_acme-challenge.example.com.",
+			expected: "_acme-challenge.example.com.",
+		},
+		{
+			name:     "Single CNAME",
+			fqdn:     "_acme-challenge.customer.com",
+			expected: "_acme-challenge.customer.com.validation.net.",
+		},
+		{
+			name:     "Chain of CNAMEs",
+			fqdn:     "_acme-challenge.two-hops.com.",
+			expected: "_acme-challenge.customer.com.validation.net.",
+		},
+		{
+			name:     "Target is lowercased",
+			fqdn:     "_acme-challenge.uppercase.com.",
+			expected: "_acme-challenge.validation.net.",
+		},
+		{
+			name:           "Loop is detected",
+			fqdn:           "_acme-challenge.loop-a.com.",
+			expectedErrMsg: "CNAME loop detected",
+		},
+		{
+			name:           "Chain longer than max hops",
+			fqdn:           "_acme-challenge.long-chain.com.",
+			maxHops:        2,
+			expectedErrMsg: "exceeds 2 hops",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resolver := &CNAMEResolver{Nameservers: []string{nameserver}, MaxHops: tc.maxHops}
+			target, err := resolver.Follow(tc.fqdn)
+
+			if tc.expectedErrMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedErrMsg) {
+					t.Errorf("Expected error message containing '%s', but got: %v", tc.expectedErrMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Expected no error, but got: %v", err)
+			}
+			if target != tc.expected {
+				t.Errorf("Expected target '%s', but got '%s'", tc.expected, target)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// configMapStore persists webhook state in the data of a single ConfigMap.
+type configMapStore struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+}
+
+// data returns the data of the ConfigMap, which is empty when it does not exist yet.
+func (s configMapStore) data(ctx context.Context) (map[string]string, error) {
+	cm, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to get ConfigMap `%s/%s`; %v", s.namespace, s.name, err)
+	}
+
+	return cm.Data, nil
+}
+
+// update applies fn to the data of the ConfigMap and writes the result back, creating the
+// ConfigMap when needed and retrying on conflicting writes.
+func (s configMapStore) update(ctx context.Context, fn func(data map[string]string) error) error {
+	configMaps := s.client.CoreV1().ConfigMaps(s.namespace)
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := configMaps.Get(ctx, s.name, metav1.GetOptions{})
+		exists := err == nil
+		if apierrors.IsNotFound(err) {
+			cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: s.name, Namespace: s.namespace}}
+		} else if err != nil {
+			return err
+		}
+
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		if err := fn(cm.Data); err != nil {
+			return err
+		}
+
+		if !exists {
+			_, err = configMaps.Create(ctx, cm, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) {
+				// Created concurrently, retry as a conflicting update
+				return apierrors.NewConflict(corev1.Resource("configmaps"), s.name, err)
+			}
+			return err
+		}
+		_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to update ConfigMap `%s/%s`; %v", s.namespace, s.name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,160 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ZoneInfo describes a zone as listed by either Hetzner DNS API.
+type ZoneInfo struct {
+	Id     string
+	Name   string
+	Status string
+	Paused bool
+	// Secondary zones are transferred from another primary nameserver and cannot be
+	// changed through the API.
+	Secondary bool
+	// Nameservers are the authoritative nameservers Hetzner assigned to the zone.
+	Nameservers []string
+}
+
+// Usable returns an error when records of the zone cannot be changed or would not be
+// served.
+func (z ZoneInfo) Usable() error {
+	switch {
+	case z.Paused:
+		return fmt.Errorf("zone `%s` is paused", z.Name)
+	case z.Secondary:
+		return fmt.Errorf("zone `%s` is a secondary zone", z.Name)
+	}
+	return nil
+}
+
+const (
+	CheckPass = "PASS"
+	CheckFail = "FAIL"
+	CheckSkip = "SKIP"
+)
+
+// DoctorCheck is the result of a single check of the doctor command.
+type DoctorCheck struct {
+	Name   string
+	Result string
+	Detail string
+}
+
+// DoctorReport collects the results of the doctor checks in the order they ran.
+type DoctorReport struct {
+	Checks []DoctorCheck
+}
+
+// Check adds the check name, failed when err is set and passed with detail otherwise. It
+// returns whether the check passed.
+func (r *DoctorReport) Check(name string, detail string, err error) bool {
+	if err != nil {
+		r.Checks = append(r.Checks, DoctorCheck{Name: name, Result: CheckFail, Detail: Redact(err.Error())})
+		return false
+	}
+	r.Checks = append(r.Checks, DoctorCheck{Name: name, Result: CheckPass, Detail: detail})
+	return true
+}
+
+// Skip adds the checks names, which did not run because of an earlier failure.
+func (r *DoctorReport) Skip(names ...string) {
+	for _, name := range names {
+		r.Checks = append(r.Checks, DoctorCheck{Name: name, Result: CheckSkip})
+	}
+}
+
+// Failures returns the number of failed checks.
+func (r *DoctorReport) Failures() int {
+	failures := 0
+	for _, check := range r.Checks {
+		if check.Result == CheckFail {
+			failures++
+		}
+	}
+	return failures
+}
+
+// Write prints the report as a table to w.
+func (r *DoctorReport) Write(w io.Writer) error {
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, check := range r.Checks {
+		fmt.Fprintf(table, "%s\t%s\t%s\n", check.Result, check.Name, check.Detail)
+	}
+	return table.Flush()
+}
+
+// LookupNS returns the lowercase nameservers the zone is delegated to, as answered by
+// the given recursive nameservers or those from /etc/resolv.conf.
+func LookupNS(zone string, nameservers []string, timeout time.Duration) ([]string, error) {
+	addresses, err := resolverAddresses(nameservers)
+	if err != nil {
+		return nil, err
+	}
+	if timeout <= 0 {
+		timeout = defaultDNSTimeout
+	}
+	client := &dns.Client{Timeout: timeout}
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(strings.ToLower(zone)), dns.TypeNS)
+
+	var errs []error
+	for _, address := range addresses {
+		in, _, err := client.Exchange(msg, address)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", address, err))
+			continue
+		}
+		if in.Rcode != dns.RcodeSuccess {
+			errs = append(errs, fmt.Errorf("%s: unexpected response code %s", address, dns.RcodeToString[in.Rcode]))
+			continue
+		}
+
+		var ns []string
+		for _, rr := range in.Answer {
+			if record, ok := rr.(*dns.NS); ok {
+				ns = append(ns, strings.ToLower(record.Ns))
+			}
+		}
+		slices.Sort(ns)
+		return ns, nil
+	}
+
+	return nil, fmt.Errorf("unable to resolve NS for '%s': %v", zone, errors.Join(errs...))
+}
+
+// CheckDelegation returns an error unless the zone is delegated to nameservers, all of
+// which are among the expected nameservers when these are known.
+func CheckDelegation(delegated, expected []string) error {
+	if len(delegated) == 0 {
+		return errors.New("zone is not delegated, no NS records found")
+	}
+	if len(expected) == 0 {
+		return nil
+	}
+
+	known := map[string]bool{}
+	for _, ns := range expected {
+		known[dns.Fqdn(strings.ToLower(ns))] = true
+	}
+	var foreign []string
+	for _, ns := range delegated {
+		if !known[dns.Fqdn(strings.ToLower(ns))] {
+			foreign = append(foreign, ns)
+		}
+	}
+	if len(foreign) > 0 {
+		return fmt.Errorf("zone is delegated to `%s`, which are not among the Hetzner nameservers `%s`", strings.Join(foreign, ", "), strings.Join(expected, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestZoneInfoUsable(t *testing.T) {
+	testCases := []struct {
+		name           string
+		zone           ZoneInfo
+		expectedErrMsg string
+	}{
+		{"primary zone", ZoneInfo{Name: "example.com", Status: "verified"}, ""},
+		{"paused zone", ZoneInfo{Name: "example.com", Paused: true}, "zone `example.com` is paused"},
+		{"secondary zone", ZoneInfo{Name: "example.com", Secondary: true}, "zone `example.com` is a secondary zone"},
+		{"secondary cloud zone", CloudZone{Id: 1, Name: "example.com", Mode: "secondary"}.Info(), "zone `example.com` is a secondary zone"},
+		{"paused legacy zone", Zone{Id: "1", Name: "example.com", Paused: true}.Info(), "zone `example.com` is paused"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.zone.Usable()
+			if tc.expectedErrMsg == "" && err != nil {
+				t.Errorf("Expected no error, but got: %v", err)
+			}
+			if tc.expectedErrMsg != "" && (err == nil || err.Error() != tc.expectedErrMsg) {
+				t.Errorf("Expected error %q, but got: %v", tc.expectedErrMsg, err)
+			}
+		})
+	}
+}
+
+func TestCheckDelegation(t *testing.T) {
+	hetzner := []string{"hydrogen.ns.hetzner.com.", "oxygen.ns.hetzner.com.", "helium.ns.hetzner.de."}
+
+	testCases := []struct {
+		name        string
+		delegated   []string
+		expected    []string
+		expectError bool
+	}{
+		{"delegated to hetzner", []string{"helium.ns.hetzner.de.", "hydrogen.ns.hetzner.com."}, hetzner, false},
+		{"case and trailing dot", []string{"Hydrogen.NS.hetzner.com"}, hetzner, false},
+		{"foreign nameserver", []string{"hydrogen.ns.hetzner.com.", "ns1.other.net."}, hetzner, true},
+		{"not delegated", nil, hetzner, true},
+		{"unknown expected nameservers", []string{"ns1.other.net."}, nil, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := CheckDelegation(tc.delegated, tc.expected)
+			if tc.expectError && err == nil {
+				t.Errorf("Expected an error, but got none")
+			}
+			if !tc.expectError && err != nil {
+				t.Errorf("Expected no error, but got: %v", err)
+			}
+		})
+	}
+}
+
+func TestLookupNS(t *testing.T) {
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		msg := new(dns.Msg)
+		msg.SetReply(r)
+		if r.Question[0].Name == "example.com." && r.Question[0].Qtype == dns.TypeNS {
+			for _, ns := range []string{"Oxygen.ns.hetzner.com.", "hydrogen.ns.hetzner.com."} {
+				msg.Answer = append(msg.Answer, &dns.NS{
+					Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 60},
+					Ns:  ns,
+				})
+			}
+		} else {
+			msg.Rcode = dns.RcodeNameError
+		}
+		_ = w.WriteMsg(msg)
+	})
+
+	started := make(chan struct{})
+	server := &dns.Server{Addr: "127.0.0.1:0", Net: "udp", Handler: handler, NotifyStartedFunc: func() { close(started) }}
+	go func() {
+		_ = server.ListenAndServe()
+	}()
+	<-started
+	defer func() { _ = server.Shutdown() }()
+	nameserver := server.PacketConn.LocalAddr().String()
+
+	ns, err := LookupNS("Example.com", []string{nameserver}, 0)
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	if expected := []string{"hydrogen.ns.hetzner.com.", "oxygen.ns.hetzner.com."}; !reflect.DeepEqual(ns, expected) {
+		t.Errorf("Expected %v, but got %v", expected, ns)
+	}
+
+	if _, err := LookupNS("missing.com", []string{nameserver}, 0); err == nil {
+		t.Errorf("Expected an error for a missing zone, but got none")
+	}
+}
+
+func TestDoctorReport(t *testing.T) {
+	RegisterSecret(testToken)
+
+	report := &DoctorReport{}
+	if !report.Check("API access", "1 zones accessible", nil) {
+		t.Errorf("Expected a passed check")
+	}
+	if report.Check("Zone", "", errors.New("rejected "+testToken)) {
+		t.Errorf("Expected a failed check")
+	}
+	report.Skip("Test record")
+
+	if failures := report.Failures(); failures != 1 {
+		t.Errorf("Expected 1 failure, but got %d", failures)
+	}
+
+	var buf bytes.Buffer
+	if err := report.Write(&buf); err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "PASS") || !strings.HasPrefix(lines[1], "FAIL") || !strings.HasPrefix(lines[2], "SKIP") {
+		t.Errorf("Unexpected report:\n%s", buf.String())
+	}
+	if strings.Contains(buf.String(), testToken) {
+		t.Errorf("Expected the token to be redacted, but got:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,46 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// domainProfile converts domain names to the ASCII (punycode) form stored by the Hetzner
+// API. Unlike idna.Lookup it accepts the underscores used by ACME challenge labels.
+var domainProfile = idna.New(
+	idna.MapForLookup(),
+	idna.Transitional(false),
+	idna.StrictDomainName(false),
+)
+
+// NormalizeDomain returns name in the form used for all zone and record handling:
+// lowercase ASCII with internationalized labels converted to punycode and without
+// trailing dot.
+// Example: name = _acme-challenge.München.de. -> _acme-challenge.xn--mnchen-3ya.de
+func NormalizeDomain(name string) (string, error) {
+	ascii, err := domainProfile.ToASCII(strings.TrimSuffix(name, "."))
+	if err != nil {
+		return "", fmt.Errorf("invalid domain name '%s': %v", name, err)
+	}
+
+	return strings.ToLower(ascii), nil
+}
+
+// normalizeDomainOrLower is NormalizeDomain for comparisons that cannot fail; names
+// that are not valid IDNs are only lowercased.
+func normalizeDomainOrLower(name string) string {
+	normalized, err := NormalizeDomain(name)
+	if err != nil {
+		return strings.ToLower(strings.TrimSuffix(name, "."))
+	}
+
+	return normalized
+}
+
+// EqualDomain reports whether a and b name the same domain after normalization.
+// Example: a = _acme-challenge.München, b = _acme-challenge.xn--mnchen-3ya -> true
+func EqualDomain(a, b string) bool {
+	return normalizeDomainOrLower(a) == normalizeDomainOrLower(b)
+}
@@ -0,0 +1,63 @@
+package internal
+
+import (
+	"testing"
+)
+
+func TestNormalizeDomain(t *testing.T) {
+	testCases := []struct {
+		name        string
+		input       string
+		expected    string
+		expectError bool
+	}{
+		{name: "ASCII name", input: "example.com", expected: "example.com"},
+		{name: "Uppercase with trailing dot", input: "Example.COM.", expected: "example.com"},
+		{name: "Challenge label is kept", input: "_acme-challenge.www.example.com.", expected: "_acme-challenge.www.example.com"},
+		{name: "Unicode zone", input: "München.de", expected: "xn--mnchen-3ya.de"},
+		{name: "Unicode challenge FQDN", input: "_acme-challenge.straße.de.", expected: "_acme-challenge.xn--strae-oqa.de"},
+		{name: "Punycode is lowercased", input: "_acme-challenge.XN--MNCHEN-3YA.de", expected: "_acme-challenge.xn--mnchen-3ya.de"},
+		{name: "Empty name", input: "", expected: ""},
+		{name: "Invalid punycode", input: "xn--a.example.com", expectError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := NormalizeDomain(tc.input)
+
+			if tc.expectError {
+				if err == nil {
+					t.Errorf("Expected an error, but got '%s'", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Expected no error, but got: %v", err)
+			}
+			if got != tc.expected {
+				t.Errorf("Expected '%s', but got '%s'", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestEqualDomain(t *testing.T) {
+	testCases := []struct {
+		a, b     string
+		expected bool
+	}{
+		{a: "_acme-challenge", b: "_ACME-challenge", expected: true},
+		{a: "_acme-challenge.München", b: "_acme-challenge.xn--mnchen-3ya", expected: true},
+		{a: "example.com.", b: "example.com", expected: true},
+		{a: "@", b: "@", expected: true},
+		{a: "_acme-challenge.www", b: "_acme-challenge", expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.a+"/"+tc.b, func(t *testing.T) {
+			if got := EqualDomain(tc.a, tc.b); got != tc.expected {
+				t.Errorf("Expected %v, but got %v", tc.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+)
+
+// Reasons of the events emitted on Challenges.
+const (
+	EventZoneResolved   = "ZoneResolved"
+	EventZoneNotFound   = "ZoneNotFound"
+	EventRecordCreated  = "RecordCreated"
+	EventRecordDeleted  = "RecordDeleted"
+	EventDeletionFailed = "DeletionFailed"
+)
+
+var challengeResource = schema.GroupVersionResource{Group: "acme.cert-manager.io", Version: "v1", Resource: "challenges"}
+
+const (
+	// challengeIndex indexes the cached Challenges by dnsName and key.
+	challengeIndex = "dnsNameKey"
+	// challengeSyncTimeout bounds the wait for the Challenge cache to fill.
+	challengeSyncTimeout = 10 * time.Second
+)
+
+// NewEventRecorder returns a recorder writing events through client.
+func NewEventRecorder(client kubernetes.Interface) record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+
+	return broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "cert-manager-webhook-hetzner"})
+}
+
+// ChallengeEvents emits events on the Challenge resources the webhook solves. Challenges
+// are looked up in a cache of all Challenges, kept up to date by a watch once Start is called.
+type ChallengeEvents struct {
+	factory  dynamicinformer.DynamicSharedInformerFactory
+	informer cache.SharedIndexInformer
+	recorder record.EventRecorder
+}
+
+func NewChallengeEvents(client dynamic.Interface, recorder record.EventRecorder) *ChallengeEvents {
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(client, 0)
+	informer := factory.ForResource(challengeResource).Informer()
+	// Both only fail once the informer is started
+	_ = informer.AddIndexers(cache.Indexers{challengeIndex: indexChallenge})
+	_ = informer.SetTransform(trimChallenge)
+
+	return &ChallengeEvents{factory: factory, informer: informer, recorder: recorder}
+}
+
+// Start fills the Challenge cache and keeps it up to date until stopCh is closed.
+func (e *ChallengeEvents) Start(stopCh <-chan struct{}) {
+	if e == nil {
+		return
+	}
+	e.factory.Start(stopCh)
+}
+
+// challengeIndexKey returns the key of the Challenge with dnsName and key in challengeIndex.
+func challengeIndexKey(dnsName, key string) string {
+	return dnsName + "/" + key
+}
+
+func indexChallenge(obj interface{}) ([]string, error) {
+	item, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, nil
+	}
+	dnsName, _, _ := unstructured.NestedString(item.Object, "spec", "dnsName")
+	key, _, _ := unstructured.NestedString(item.Object, "spec", "key")
+
+	return []string{challengeIndexKey(dnsName, key)}, nil
+}
+
+// trimChallenge drops all fields of a cached Challenge but those of its reference and
+// index, so that the cache stays small.
+func trimChallenge(obj interface{}) (interface{}, error) {
+	item, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return obj, nil
+	}
+	dnsName, _, _ := unstructured.NestedString(item.Object, "spec", "dnsName")
+	key, _, _ := unstructured.NestedString(item.Object, "spec", "key")
+
+	trimmed := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{"dnsName": dnsName, "key": key},
+	}}
+	trimmed.SetAPIVersion(item.GetAPIVersion())
+	trimmed.SetKind(item.GetKind())
+	trimmed.SetNamespace(item.GetNamespace())
+	trimmed.SetName(item.GetName())
+	trimmed.SetUID(item.GetUID())
+	trimmed.SetResourceVersion(item.GetResourceVersion())
+	return trimmed, nil
+}
+
+// For returns the recorder of the Challenge with dnsName and key. The Challenge is looked up
+// with the first event.
+func (e *ChallengeEvents) For(dnsName, key string) *ChallengeRecorder {
+	if e == nil {
+		return nil
+	}
+	return &ChallengeRecorder{events: e, dnsName: dnsName, key: key}
+}
+
+// findChallenge returns a reference to the Challenge with dnsName and key, or nil when
+// there is none. Challenges are searched in all namespaces, as the namespace cert-manager
+// passes to the webhook is that of the issuer's secrets, and the Challenge UID is not
+// passed at all.
+func (e *ChallengeEvents) findChallenge(ctx context.Context, dnsName, key string) (*corev1.ObjectReference, error) {
+	ctx, cancel := context.WithTimeout(ctx, challengeSyncTimeout)
+	defer cancel()
+	if !cache.WaitForCacheSync(ctx.Done(), e.informer.HasSynced) {
+		return nil, fmt.Errorf("challenge cache not synced; %v", ctx.Err())
+	}
+
+	items, err := e.informer.GetIndexer().ByIndex(challengeIndex, challengeIndexKey(dnsName, key))
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+
+	item, ok := items[0].(*unstructured.Unstructured)
+	if !ok {
+		return nil, nil
+	}
+	return &corev1.ObjectReference{
+		APIVersion:      item.GetAPIVersion(),
+		Kind:            item.GetKind(),
+		Namespace:       item.GetNamespace(),
+		Name:            item.GetName(),
+		UID:             item.GetUID(),
+		ResourceVersion: item.GetResourceVersion(),
+	}, nil
+}
+
+// ChallengeRecorder emits events on a single Challenge. A nil recorder discards them.
+type ChallengeRecorder struct {
+	events       *ChallengeEvents
+	dnsName, key string
+
+	once sync.Once
+	ref  *corev1.ObjectReference
+}
+
+// Challenge returns a reference to the Challenge, or nil when it cannot be found.
+func (r *ChallengeRecorder) Challenge() *corev1.ObjectReference {
+	if r == nil {
+		return nil
+	}
+
+	r.once.Do(func() {
+		ref, err := r.events.findChallenge(context.TODO(), r.dnsName, r.key)
+		if err != nil {
+			klog.InfoS("Unable to find Challenge", "dnsName", r.dnsName, "err", err)
+			return
+		}
+		if ref == nil {
+			klog.V(4).InfoS("No Challenge found", "dnsName", r.dnsName)
+			return
+		}
+		r.ref = ref
+	})
+
+	return r.ref
+}
+
+// Eventf emits an event of eventtype with reason on the Challenge, if it can be found.
+func (r *ChallengeRecorder) Eventf(eventtype, reason, messageFmt string, args ...interface{}) {
+	ref := r.Challenge()
+	if ref == nil {
+		return
+	}
+
+	r.events.recorder.Eventf(ref, eventtype, reason, messageFmt, args...)
+}
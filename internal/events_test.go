@@ -0,0 +1,83 @@
+package internal
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func challenge(namespace, name, uid, dnsName, key string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "acme.cert-manager.io/v1",
+		"kind":       "Challenge",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": namespace,
+			"uid":       uid,
+		},
+		"spec": map[string]interface{}{
+			"dnsName": dnsName,
+			"key":     key,
+		},
+	}}
+}
+
+func TestChallengeRecorder(t *testing.T) {
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{challengeResource: "ChallengeList"},
+		challenge("default", "example-com-1", "uid-1", "example.com", "key-1"),
+		challenge("team-a", "example-com-2", "uid-2", "example.com", "key-2"),
+	)
+
+	recorder := record.NewFakeRecorder(10)
+	challengeEvents := NewChallengeEvents(client, recorder)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	challengeEvents.Start(stopCh)
+
+	testCases := []struct {
+		name         string
+		key          string
+		expectEvents int
+	}{
+		{"by dns name and key", "key-1", 1},
+		{"in another namespace", "key-2", 1},
+		{"unknown key", "key-3", 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			events := challengeEvents.For("example.com", tc.key)
+
+			events.Eventf(corev1.EventTypeNormal, EventRecordCreated, "Created TXT record `%s`", "_acme-challenge")
+
+			if len(recorder.Events) != tc.expectEvents {
+				t.Fatalf("Expected %d events, but got %d", tc.expectEvents, len(recorder.Events))
+			}
+			if tc.expectEvents > 0 {
+				if event := <-recorder.Events; event != "Normal RecordCreated Created TXT record `_acme-challenge`" {
+					t.Errorf("Unexpected event %q", event)
+				}
+			}
+		})
+	}
+
+	// Challenges are looked up in the cache, not listed for every lookup
+	lists := 0
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "list" {
+			lists++
+		}
+	}
+	if lists != 1 {
+		t.Errorf("Expected Challenges to be listed once, but got %d lists", lists)
+	}
+
+	var nilRecorder *ChallengeRecorder
+	nilRecorder.Eventf(corev1.EventTypeWarning, EventZoneNotFound, "discarded")
+}
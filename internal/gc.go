@@ -0,0 +1,44 @@
+package internal
+
+import (
+	"strings"
+	"time"
+)
+
+// Orphan is an owned record that outlived the challenge it was created for.
+type Orphan struct {
+	OwnedEntry
+	// Exists is false when the record is already gone from the zone, in which case
+	// only its ownership entry has to be removed.
+	Exists bool
+}
+
+// FindOrphans returns the entries of owned that belong to clusterId and were created
+// before cutoff, matched against the records currently in their zone. It also returns
+// the _acme-challenge TXT records of the zone that are not owned by the webhook, which
+// are never deleted.
+func FindOrphans(owned []OwnedEntry, zoneRecords []Record, clusterId string, cutoff time.Time) ([]Orphan, []Record) {
+	inZone := make(map[string]bool, len(zoneRecords))
+	for _, record := range zoneRecords {
+		inZone[record.Id] = true
+	}
+
+	ownedIds := make(map[string]bool, len(owned))
+	var orphans []Orphan
+	for _, entry := range owned {
+		ownedIds[entry.RecordId] = true
+		if entry.ClusterId != clusterId || !entry.Created.Before(cutoff) {
+			continue
+		}
+		orphans = append(orphans, Orphan{OwnedEntry: entry, Exists: inZone[entry.RecordId]})
+	}
+
+	var unowned []Record
+	for _, record := range zoneRecords {
+		if record.Type == "TXT" && strings.HasPrefix(record.Name, "_acme-challenge") && !ownedIds[record.Id] {
+			unowned = append(unowned, record)
+		}
+	}
+
+	return orphans, unowned
+}
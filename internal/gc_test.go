@@ -0,0 +1,43 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFindOrphans(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	cutoff := now.Add(-24 * time.Hour)
+	old := now.Add(-48 * time.Hour)
+
+	owned := []OwnedEntry{
+		{Key: "uid-old", OwnedRecord: OwnedRecord{ClusterId: "a", RecordId: "r1", Created: old}},
+		{Key: "uid-recent", OwnedRecord: OwnedRecord{ClusterId: "a", RecordId: "r2", Created: now}},
+		{Key: "uid-gone", OwnedRecord: OwnedRecord{ClusterId: "a", RecordId: "r3", Created: old}},
+		{Key: "uid-other-cluster", OwnedRecord: OwnedRecord{ClusterId: "b", RecordId: "r4", Created: old}},
+	}
+	zoneRecords := []Record{
+		{Id: "r1", Type: "TXT", Name: "_acme-challenge"},
+		{Id: "r2", Type: "TXT", Name: "_acme-challenge.www"},
+		{Id: "r4", Type: "TXT", Name: "_acme-challenge"},
+		{Id: "r5", Type: "TXT", Name: "_acme-challenge.manual"},
+		{Id: "r6", Type: "TXT", Name: "@"},
+		{Id: "r7", Type: "A", Name: "_acme-challenge"},
+	}
+
+	orphans, unowned := FindOrphans(owned, zoneRecords, "a", cutoff)
+
+	if len(orphans) != 2 {
+		t.Fatalf("Expected 2 orphans, but got %v", orphans)
+	}
+	if orphans[0].Key != "uid-old" || !orphans[0].Exists {
+		t.Errorf("Expected existing orphan uid-old, but got %+v", orphans[0])
+	}
+	if orphans[1].Key != "uid-gone" || orphans[1].Exists {
+		t.Errorf("Expected missing orphan uid-gone, but got %+v", orphans[1])
+	}
+
+	if len(unowned) != 1 || unowned[0].Id != "r5" {
+		t.Errorf("Expected only r5 to be reported as unowned, but got %v", unowned)
+	}
+}
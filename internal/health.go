@@ -0,0 +1,164 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog/v2"
+)
+
+var apiUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: metricsNamespace,
+	Name:      "api_up",
+	Help:      "Whether the last health check of a Hetzner API endpoint succeeded.",
+}, []string{"url"})
+
+func init() {
+	MetricsRegistry.MustRegister(apiUp)
+}
+
+// APIHealth periodically checks that the Hetzner API endpoints in use are reachable and,
+// for endpoints with a token, that the token is accepted. It serves the result as a
+// readiness check.
+type APIHealth struct {
+	client *http.Client
+
+	mu      sync.RWMutex
+	tokens  map[string]string
+	results map[string]error
+	checked bool
+}
+
+func NewAPIHealth(timeout time.Duration) *APIHealth {
+	return &APIHealth{
+		client:  &http.Client{Timeout: timeout},
+		tokens:  map[string]string{},
+		results: map[string]error{},
+	}
+}
+
+// AddEndpoint adds the API at url to the checked endpoints. With a token, the check also
+// verifies that the token is accepted; an endpoint keeps the first token it was added with.
+// A nil APIHealth ignores endpoints.
+func (h *APIHealth) AddEndpoint(url, token string) {
+	if h == nil || url == "" {
+		return
+	}
+	url = strings.TrimSuffix(url, "/")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if existing, ok := h.tokens[url]; !ok || existing == "" {
+		h.tokens[url] = token
+	}
+}
+
+// Run checks all endpoints every interval until ctx is done.
+func (h *APIHealth) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		h.CheckAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckAll checks all endpoints once.
+func (h *APIHealth) CheckAll(ctx context.Context) {
+	h.mu.RLock()
+	tokens := make(map[string]string, len(h.tokens))
+	for url, token := range h.tokens {
+		tokens[url] = token
+	}
+	h.mu.RUnlock()
+
+	results := make(map[string]error, len(tokens))
+	for url, token := range tokens {
+		err := h.check(ctx, url, token)
+		if err != nil {
+			klog.FromContext(ctx).Info("Hetzner API health check failed", "url", url, "err", err)
+			apiUp.WithLabelValues(url).Set(0)
+		} else {
+			apiUp.WithLabelValues(url).Set(1)
+		}
+		results[url] = err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.results = results
+	h.checked = true
+}
+
+// check requests the zones of the API at url. Without a token, any answer but a server
+// error shows that the API is reachable.
+func (h *APIHealth) check(ctx context.Context, url, token string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url+"/zones?per_page=1", nil)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unreachable; %v", err)
+	}
+	_ = resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 500:
+		return fmt.Errorf("answered %s", resp.Status)
+	case token != "" && (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden):
+		return fmt.Errorf("token rejected with %s", resp.Status)
+	}
+	return nil
+}
+
+// Ready returns an error describing the failing endpoints, or nil when all endpoints
+// passed their last check or none are configured.
+func (h *APIHealth) Ready() error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if len(h.tokens) == 0 {
+		return nil
+	}
+	if !h.checked {
+		return errors.New("Hetzner API endpoints not checked yet")
+	}
+
+	var failures []string
+	for url, err := range h.results {
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", url, err))
+		}
+	}
+	if len(failures) == 0 {
+		return nil
+	}
+	sort.Strings(failures)
+	return errors.New(strings.Join(failures, "; "))
+}
+
+// ServeHTTP answers readiness probes.
+func (h *APIHealth) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	if err := h.Ready(); err != nil {
+		http.Error(w, Redact(err.Error()), http.StatusServiceUnavailable)
+		return
+	}
+	_, _ = w.Write([]byte("ok"))
+}
@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAPIHealth(t *testing.T) {
+	status := http.StatusUnauthorized
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/zones" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") == "Bearer valid-token" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	testCases := []struct {
+		name        string
+		token       string
+		status      int
+		expectReady bool
+	}{
+		{"reachable without token", "", http.StatusUnauthorized, true},
+		{"server error", "", http.StatusBadGateway, false},
+		{"valid token", "valid-token", http.StatusUnauthorized, true},
+		{"rejected token", "revoked-token", http.StatusUnauthorized, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			status = tc.status
+			health := NewAPIHealth(time.Second)
+			health.AddEndpoint(server.URL+"/", tc.token)
+
+			if err := health.Ready(); err == nil {
+				t.Errorf("Expected not ready before the first check")
+			}
+
+			health.CheckAll(context.Background())
+			err := health.Ready()
+			if tc.expectReady && err != nil {
+				t.Errorf("Expected ready, but got: %v", err)
+			}
+			if !tc.expectReady && err == nil {
+				t.Errorf("Expected not ready, but got ready")
+			}
+
+			recorder := httptest.NewRecorder()
+			health.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if expected := map[bool]int{true: http.StatusOK, false: http.StatusServiceUnavailable}[tc.expectReady]; recorder.Code != expected {
+				t.Errorf("Expected status %d, but got %d", expected, recorder.Code)
+			}
+		})
+	}
+}
+
+func TestAPIHealthUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	health := NewAPIHealth(time.Second)
+	health.AddEndpoint(url, "")
+	health.CheckAll(context.Background())
+
+	if err := health.Ready(); err == nil {
+		t.Errorf("Expected an unreachable endpoint to fail readiness")
+	}
+
+	var nilHealth *APIHealth
+	nilHealth.AddEndpoint(url, "")
+
+	if err := NewAPIHealth(time.Second).Ready(); err != nil {
+		t.Errorf("Expected ready without endpoints, but got: %v", err)
+	}
+}
@@ -1,14 +1,83 @@
 package internal
 
 import (
+	"errors"
 	"fmt"
+	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
+	"golang.org/x/net/publicsuffix"
 	"k8s.io/klog/v2"
 )
 
 type Config struct {
 	ApiKey, ZoneName, ApiUrl string
+	// ApiFlavor is the API spoken at ApiUrl, ApiFlavorLegacy or ApiFlavorCloud.
+	ApiFlavor string
+	// Fqdn is the name the TXT record is written to, the challenge FQDN or the target
+	// of its CNAME chain.
+	Fqdn string
+	// LegacyCleanup deletes records by name and value instead of by ownership.
+	LegacyCleanup bool
+	// SecretNamespace, SecretName and SecretKey reference the secret holding ApiKey.
+	SecretNamespace, SecretName, SecretKey string
+}
+
+// APIError is returned for unsuccessful responses of the Hetzner API.
+type APIError struct {
+	StatusCode          int
+	Status, Url, Method string
+}
+
+func (e *APIError) Error() string {
+	return "Error calling API status:" + e.Status + " url: " + e.Url + " method: " + e.Method
+}
+
+// IsNotFound reports whether err is an APIError for a resource that does not exist.
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// RetryAfter returns how long to wait before retrying a rate limited request whose
+// response carried the Retry-After header value, at least one second and at most limit.
+func RetryAfter(header string, now time.Time, limit time.Duration) time.Duration {
+	wait := time.Second
+	if seconds, err := strconv.Atoi(header); err == nil {
+		wait = time.Duration(seconds) * time.Second
+	} else if at, err := http.ParseTime(header); err == nil {
+		wait = at.Sub(now)
+	}
+
+	return min(max(wait, time.Second), limit)
+}
+
+// ZoneNotFoundError is returned when no Hetzner zone exists for Domain, or, when Parents
+// is set, for any of its parents either.
+type ZoneNotFoundError struct {
+	Domain  string
+	Parents bool
+}
+
+func (e *ZoneNotFoundError) Error() string {
+	if e.Parents {
+		return fmt.Sprintf("unable to find a registered Hetzner DNS zone for domain: %s or its parents", e.Domain)
+	}
+	return fmt.Sprintf("zone `%s` not found", e.Domain)
+}
+
+// IsZoneNotFound reports whether err is a ZoneNotFoundError.
+func IsZoneNotFound(err error) bool {
+	var notFound *ZoneNotFoundError
+	return errors.As(err, &notFound)
+}
+
+// IsConflict reports whether err is an APIError for a resource that already exists.
+func IsConflict(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict
 }
 
 type RecordResponse struct {
@@ -16,6 +85,10 @@ type RecordResponse struct {
 	Meta    Meta     `json:"meta"`
 }
 
+type RecordCreateResponse struct {
+	Record Record `json:"record"`
+}
+
 type ZoneResponse struct {
 	Zones []Zone `json:"zones"`
 	Meta  Meta   `json:"meta"`
@@ -64,50 +137,86 @@ type Zone struct {
 	TxtVerification Verification `json:"txt_verification"`
 }
 
+// Info returns the description of the zone shared by both APIs.
+func (z Zone) Info() ZoneInfo {
+	return ZoneInfo{
+		Id:          z.Id,
+		Name:        z.Name,
+		Status:      z.Status,
+		Paused:      z.Paused,
+		Secondary:   z.IsSecondaryDns,
+		Nameservers: z.Ns,
+	}
+}
+
 type Verification struct {
 	Name  string `json:"name"`
 	Token string `json:"token"`
 }
 
-// zoneIdSearcher defines the function signature for searching a zone ID by name.
+// ZoneIdSearcher defines the function signature for searching a zone ID by name.
 // This allows mocking the search functionality for testing.
-type zoneIdSearcher func(zoneName string) (string, error)
-
-func searchZoneName(searchZone string, searcher zoneIdSearcher) (string, error) {
-	// Normalize searchZone by removing any potential trailing dot
-	normalizedSearchZone := strings.TrimSuffix(searchZone, ".")
-	parts := strings.Split(normalizedSearchZone, ".")
-
-	// Need at least 2 parts (e.g., domain.com) to form a potential zone
-	if len(parts) < 2 {
-		return "", fmt.Errorf("unable to determine potential zones from searchZone: %s", searchZone)
+type ZoneIdSearcher func(zoneName string) (string, error)
+
+// SearchZoneName attempts to find the correct Hetzner zone name for a given FQDN (searchZone)
+// by iteratively querying parent domains. The returned zone name is normalized (see NormalizeDomain).
+func SearchZoneName(searchZone string, searcher ZoneIdSearcher) (string, error) {
+	// Normalize searchZone to the lowercase punycode form without trailing dot used by the API
+	normalizedSearchZone, err := NormalizeDomain(searchZone)
+	if err != nil {
+		return "", err
 	}
+	candidates, err := zoneCandidates(normalizedSearchZone)
+	if err != nil {
+		return "", fmt.Errorf("unable to determine potential zones from searchZone: %s; %v", searchZone, err)
+	}
+	klog.V(4).InfoS("Searching zone", "domain", searchZone, "candidates", candidates)
 
 	// Iterate from the most specific potential zone (e.g., sub.domain.com)
-	// down to the least specific (e.g., domain.com).
-	// The loop goes from i=0 (full domain) up to len(parts)-2 (TLD+1).
-	for i := 0; i <= len(parts)-2; i++ {
-		potentialZoneName := strings.Join(parts[i:], ".")
+	// down to the least specific, the registrable domain (e.g., domain.com or domain.co.uk).
+	for _, potentialZoneName := range candidates {
+		klog.V(4).InfoS("Looking up zone via API", "zone", potentialZoneName)
 		zoneId, err := searcher(potentialZoneName) // Use the provided searcher function
 
 		if err != nil {
 			// Log the error from searchZoneId (e.g., API error, unexpected multiple zones)
 			// but continue searching parent domains as the error might be specific to this level.
-			klog.Warningf("Error searching for zone ID for '%s': %v. Trying parent domain.", potentialZoneName, err)
+			klog.InfoS("Error searching for zone ID, trying parent domain", "zone", potentialZoneName, "err", err)
 			// Continue to the next iteration (parent domain)
 		}
 
 		if zoneId != "" {
 			// Found the zone successfully
-			klog.Infof("Found ZoneName: %s (searched using FQDN: %s)", potentialZoneName, searchZone)
+			klog.InfoS("Found zone", "zone", potentialZoneName, "domain", searchZone)
 			return potentialZoneName, nil
 		}
 
 		// If zoneId is empty and err was nil, it means the zone wasn't found at this level.
 		// Continue to the parent domain.
-		klog.V(4).Infof("Zone '%s' not found via API, trying parent.", potentialZoneName)
+		klog.V(4).InfoS("Zone not found via API, trying parent", "zone", potentialZoneName)
 	}
 
 	// If the loop completes without finding a zone ID for any potential zone name
-	return "", fmt.Errorf("unable to find a registered Hetzner DNS zone for domain: %s or its parents", searchZone)
+	return "", &ZoneNotFoundError{Domain: searchZone, Parents: true}
+}
+
+// zoneCandidates returns the potential zone names for a normalized domain, from the domain
+// itself down to its registrable domain according to the Public Suffix List. Public suffixes
+// such as co.uk are never returned as they cannot be registered as a zone.
+// Example: domain = sub.example.co.uk -> [sub.example.co.uk example.co.uk]
+func zoneCandidates(domain string) ([]string, error) {
+	registrable, err := publicsuffix.EffectiveTLDPlusOne(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.Split(domain, ".")
+	bound := len(parts) - strings.Count(registrable, ".") - 1
+
+	candidates := make([]string, 0, bound+1)
+	for i := 0; i <= bound; i++ {
+		candidates = append(candidates, strings.Join(parts[i:], "."))
+	}
+
+	return candidates, nil
 }
@@ -2,13 +2,15 @@ package internal
 
 import (
 	"fmt"
+	"net/http"
 	"strings"
 	"testing"
+	"time"
 )
 
 // mockZoneIdSearcher simulates the behavior of searching for a zone ID.
 // It returns a predefined zone ID or error based on the input zone name.
-func mockZoneIdSearcher(zones map[string]string, errs map[string]error) zoneIdSearcher {
+func mockZoneIdSearcher(zones map[string]string, errs map[string]error) ZoneIdSearcher {
 	return func(zoneName string) (string, error) {
 		if err, exists := errs[zoneName]; exists {
 			return "", err
@@ -110,6 +112,40 @@ func TestSearchZoneName(t *testing.T) {
 			expectError:    true,
 			expectedErrMsg: "unable to determine potential zones",
 		},
+		{
+			name:         "Multi-label public suffix finds registrable zone",
+			searchZone:   "sub.example.co.uk",
+			mockZones:    map[string]string{"example.co.uk": "zone-uk"},
+			mockErrs:     map[string]error{},
+			expectedZone: "example.co.uk",
+			expectError:  false,
+		},
+		{
+			name:           "Public suffix is never queried",
+			searchZone:     "sub.unknown.co.uk",
+			mockZones:      map[string]string{"co.uk": "zone-suffix"},
+			mockErrs:       map[string]error{},
+			expectedZone:   "",
+			expectError:    true,
+			expectedErrMsg: "unable to find a registered Hetzner DNS zone",
+		},
+		{
+			name:           "Invalid input - public suffix",
+			searchZone:     "com.de",
+			mockZones:      map[string]string{},
+			mockErrs:       map[string]error{},
+			expectedZone:   "",
+			expectError:    true,
+			expectedErrMsg: "unable to determine potential zones",
+		},
+		{
+			name:         "Unicode domain finds punycode zone",
+			searchZone:   "sub.München.de.",
+			mockZones:    map[string]string{"xn--mnchen-3ya.de": "zone789"},
+			mockErrs:     map[string]error{},
+			expectedZone: "xn--mnchen-3ya.de",
+			expectError:  false,
+		},
 		{
 			name:       "Specific subdomain exists, parent also exists",
 			searchZone: "specific.example.com",
@@ -126,7 +162,7 @@ func TestSearchZoneName(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			searcher := mockZoneIdSearcher(tc.mockZones, tc.mockErrs)
-			foundZone, err := searchZoneName(tc.searchZone, searcher)
+			foundZone, err := SearchZoneName(tc.searchZone, searcher)
 
 			if tc.expectError {
 				if err == nil {
@@ -145,3 +181,58 @@ func TestSearchZoneName(t *testing.T) {
 		})
 	}
 }
+
+func TestZoneCandidates(t *testing.T) {
+	testCases := []struct {
+		domain      string
+		expected    []string
+		expectError bool
+	}{
+		{domain: "example.com", expected: []string{"example.com"}},
+		{domain: "_acme-challenge.www.example.com", expected: []string{"_acme-challenge.www.example.com", "www.example.com", "example.com"}},
+		{domain: "www.example.co.uk", expected: []string{"www.example.co.uk", "example.co.uk"}},
+		{domain: "shop.example.com.de", expected: []string{"shop.example.com.de", "example.com.de"}},
+		{domain: "co.uk", expectError: true},
+		{domain: "com", expectError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.domain, func(t *testing.T) {
+			candidates, err := zoneCandidates(tc.domain)
+
+			if tc.expectError {
+				if err == nil {
+					t.Errorf("Expected an error, but got %v", candidates)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Expected no error, but got: %v", err)
+			}
+			if strings.Join(candidates, ",") != strings.Join(tc.expected, ",") {
+				t.Errorf("Expected candidates %v, but got %v", tc.expected, candidates)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		header   string
+		expected time.Duration
+	}{
+		{"", time.Second},
+		{"5", 5 * time.Second},
+		{"0", time.Second},
+		{"3600", 30 * time.Second},
+		{now.Add(10 * time.Second).Format(http.TimeFormat), 10 * time.Second},
+		{"invalid", time.Second},
+	}
+
+	for _, tc := range testCases {
+		if wait := RetryAfter(tc.header, now, 30*time.Second); wait != tc.expected {
+			t.Errorf("Expected a wait of %s for %q, but got %s", tc.expected, tc.header, wait)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package hetznertest
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/trijpstra-fourlights/cert-manager-webhook-hetzner/internal"
+)
+
+// cloudHandler serves the zones, rrsets and actions of the Cloud DNS API, which groups
+// the records of a name and type into an rrset. Every change starts an action.
+func (s *Server) cloudHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /zones", s.cloudZones)
+	mux.HandleFunc("GET /zones/{zone}", s.cloudZone)
+	// Actions share their path with the collections of a zone
+	mux.HandleFunc("GET /zones/{zone}/{collection}", func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.PathValue("zone") == "actions":
+			s.cloudAction(w, r)
+		case r.PathValue("collection") == "rrsets":
+			s.cloudRRSets(w, r)
+		default:
+			writeError(w, http.StatusNotFound, "not found")
+		}
+	})
+	mux.HandleFunc("POST /zones/{zone}/rrsets", s.cloudCreateRRSet)
+	mux.HandleFunc("GET /zones/{zone}/rrsets/{name}/{type}", s.cloudRRSet)
+	mux.HandleFunc("DELETE /zones/{zone}/rrsets/{name}/{type}", s.cloudDeleteRRSet)
+	mux.HandleFunc("POST /zones/{zone}/rrsets/{name}/{type}/actions/add_records", s.cloudAddRecords)
+	mux.HandleFunc("POST /zones/{zone}/rrsets/{name}/{type}/actions/remove_records", s.cloudRemoveRecords)
+	return mux
+}
+
+func cloudZone(z *zone) internal.CloudZone {
+	mode := "primary"
+	if z.Secondary {
+		mode = "secondary"
+	}
+	return internal.CloudZone{
+		Id:     z.id,
+		Name:   z.Name,
+		Mode:   mode,
+		Status: "ok",
+		AuthoritativeNameservers: internal.CloudAuthoritativeNameservers{
+			Assigned: z.Nameservers,
+		},
+	}
+}
+
+// rrsets returns the rrsets of z, in the order their first record was added.
+func (z *zone) rrsets() []internal.CloudRRSet {
+	var rrsets []internal.CloudRRSet
+	index := map[string]int{}
+	for _, record := range z.records {
+		key := record.Name + "/" + record.Type
+		i, ok := index[key]
+		if !ok {
+			i = len(rrsets)
+			index[key] = i
+			rrsets = append(rrsets, internal.CloudRRSet{
+				Id:     key,
+				Name:   record.Name,
+				Type:   record.Type,
+				Ttl:    record.Ttl,
+				Labels: z.labels[key],
+				Zone:   z.id,
+			})
+		}
+		rrsets[i].Records = append(rrsets[i].Records, internal.CloudRecord{Value: record.Value})
+	}
+	return rrsets
+}
+
+// rrset returns the rrset name and type of z.
+func (z *zone) rrset(name, recordType string) (internal.CloudRRSet, bool) {
+	for _, rrset := range z.rrsets() {
+		if rrset.Name == name && rrset.Type == recordType {
+			return rrset, true
+		}
+	}
+	return internal.CloudRRSet{}, false
+}
+
+// startAction returns a new action for command, running for ActionPolls polls.
+func (s *Server) startAction(command string) internal.CloudActionResponse {
+	s.nextId++
+	a := &action{CloudAction: internal.CloudAction{Id: s.nextId, Command: command, Status: internal.ActionStatusSuccess}, polls: s.ActionPolls}
+	if a.polls > 0 {
+		a.Status = internal.ActionStatusRunning
+	}
+	s.actions[a.Id] = a
+
+	started := a.CloudAction
+	return internal.CloudActionResponse{Action: &started}
+}
+
+// changeableZone returns the zone of the request if it exists and can be changed,
+// answering with an error otherwise.
+func (s *Server) changeableZone(w http.ResponseWriter, r *http.Request) *zone {
+	z := s.zoneById(r.PathValue("zone"))
+	switch {
+	case z == nil:
+		writeError(w, http.StatusNotFound, "zone not found")
+		return nil
+	case z.Secondary && r.Method != http.MethodGet:
+		writeError(w, http.StatusUnprocessableEntity, "zone is a secondary zone")
+		return nil
+	}
+	return z
+}
+
+func (s *Server) cloudZones(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	zones, meta := page(s, r, s.zonesNamed(r.URL.Query().Get("name")))
+	response := internal.CloudZoneResponse{Zones: []internal.CloudZone{}, Meta: meta}
+	for _, z := range zones {
+		response.Zones = append(response.Zones, cloudZone(z))
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) cloudZone(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	z := s.changeableZone(w, r)
+	if z == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]internal.CloudZone{"zone": cloudZone(z)})
+}
+
+func (s *Server) cloudAction(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, _ := strconv.ParseInt(r.PathValue("collection"), 10, 64)
+	a, ok := s.actions[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "action not found")
+		return
+	}
+	if a.Status == internal.ActionStatusRunning {
+		if a.polls--; a.polls <= 0 {
+			a.Status = internal.ActionStatusSuccess
+		}
+	}
+
+	current := a.CloudAction
+	writeJSON(w, http.StatusOK, internal.CloudActionResponse{Action: &current})
+}
+
+func (s *Server) cloudRRSets(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	z := s.changeableZone(w, r)
+	if z == nil {
+		return
+	}
+
+	var rrsets []internal.CloudRRSet
+	for _, rrset := range z.rrsets() {
+		if t := r.URL.Query().Get("type"); t != "" && t != rrset.Type {
+			continue
+		}
+		if name := r.URL.Query().Get("name"); name != "" && name != rrset.Name {
+			continue
+		}
+		rrsets = append(rrsets, rrset)
+	}
+
+	rrsets, meta := page(s, r, rrsets)
+	writeJSON(w, http.StatusOK, internal.CloudRRSetsResponse{RRSets: append([]internal.CloudRRSet{}, rrsets...), Meta: meta})
+}
+
+func (s *Server) cloudCreateRRSet(w http.ResponseWriter, r *http.Request) {
+	var request internal.CloudRRSet
+	if !decode(w, r, &request) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	z := s.changeableZone(w, r)
+	if z == nil {
+		return
+	}
+	if request.Name == "" || request.Type == "" || len(request.Records) == 0 {
+		writeError(w, http.StatusUnprocessableEntity, "name, type and records are required")
+		return
+	}
+	if _, exists := z.rrset(request.Name, request.Type); exists {
+		writeError(w, http.StatusConflict, "rrset already exists")
+		return
+	}
+
+	for _, record := range request.Records {
+		s.addRecord(z, request.Name, request.Type, record.Value, request.Ttl)
+	}
+	if len(request.Labels) > 0 {
+		z.labels[request.Name+"/"+request.Type] = request.Labels
+	}
+
+	rrset, _ := z.rrset(request.Name, request.Type)
+	writeJSON(w, http.StatusCreated, struct {
+		RRSet internal.CloudRRSet `json:"rrset"`
+		internal.CloudActionResponse
+	}{rrset, s.startAction("create_rrset")})
+}
+
+func (s *Server) cloudRRSet(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	z := s.changeableZone(w, r)
+	if z == nil {
+		return
+	}
+	rrset, ok := z.rrset(r.PathValue("name"), r.PathValue("type"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "rrset not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, internal.CloudRRSetResponse{RRSet: rrset})
+}
+
+func (s *Server) cloudDeleteRRSet(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	z := s.changeableZone(w, r)
+	if z == nil {
+		return
+	}
+	name, recordType := r.PathValue("name"), r.PathValue("type")
+	if _, ok := z.rrset(name, recordType); !ok {
+		writeError(w, http.StatusNotFound, "rrset not found")
+		return
+	}
+
+	z.records = slices.DeleteFunc(z.records, func(record *Record) bool {
+		return record.Name == name && record.Type == recordType
+	})
+	delete(z.labels, name+"/"+recordType)
+	writeJSON(w, http.StatusCreated, s.startAction("delete_rrset"))
+}
+
+func (s *Server) cloudAddRecords(w http.ResponseWriter, r *http.Request) {
+	var request internal.CloudRecordsRequest
+	if !decode(w, r, &request) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	z := s.changeableZone(w, r)
+	if z == nil {
+		return
+	}
+	name, recordType := r.PathValue("name"), r.PathValue("type")
+
+	// Adding to a missing rrset creates it, values already present are kept once
+	existing, _ := z.rrset(name, recordType)
+	for _, record := range request.Records {
+		if !slices.ContainsFunc(existing.Records, func(e internal.CloudRecord) bool { return e.Value == record.Value }) {
+			s.addRecord(z, name, recordType, record.Value, request.Ttl)
+		}
+	}
+	writeJSON(w, http.StatusCreated, s.startAction("add_rrset_records"))
+}
+
+func (s *Server) cloudRemoveRecords(w http.ResponseWriter, r *http.Request) {
+	var request internal.CloudRecordsRequest
+	if !decode(w, r, &request) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	z := s.changeableZone(w, r)
+	if z == nil {
+		return
+	}
+	name, recordType := r.PathValue("name"), r.PathValue("type")
+	if _, ok := z.rrset(name, recordType); !ok {
+		writeError(w, http.StatusNotFound, "rrset not found")
+		return
+	}
+
+	// Like the API, an rrset is deleted with its last record
+	z.records = slices.DeleteFunc(z.records, func(record *Record) bool {
+		return record.Name == name && record.Type == recordType &&
+			slices.ContainsFunc(request.Records, func(removed internal.CloudRecord) bool { return removed.Value == record.Value })
+	})
+	if _, ok := z.rrset(name, recordType); !ok {
+		delete(z.labels, name+"/"+recordType)
+	}
+	writeJSON(w, http.StatusCreated, s.startAction("remove_rrset_records"))
+}
@@ -0,0 +1,106 @@
+package hetznertest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// defaultDNSTtl is served for records created without a TTL.
+const defaultDNSTtl = 60
+
+// StartDNS serves the records of the fake on a local UDP port until the test finishes,
+// authoritative for all its zones, and returns the address of the server.
+func (s *Server) StartDNS(t testing.TB) string {
+	t.Helper()
+
+	started := make(chan struct{})
+	server := &dns.Server{Addr: "127.0.0.1:0", Net: "udp", Handler: s, NotifyStartedFunc: func() { close(started) }}
+	go func() {
+		_ = server.ListenAndServe()
+	}()
+	<-started
+	t.Cleanup(func() {
+		_ = server.Shutdown()
+	})
+
+	return server.PacketConn.LocalAddr().String()
+}
+
+// ServeDNS answers queries for the records of the fake. Names without records answer
+// NXDOMAIN, names outside all zones are refused.
+func (s *Server) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	msg := new(dns.Msg)
+	msg.SetReply(r)
+	msg.Authoritative = true
+	if len(r.Question) != 1 {
+		msg.Rcode = dns.RcodeFormatError
+		_ = w.WriteMsg(msg)
+		return
+	}
+	question := r.Question[0]
+	owner := dns.Fqdn(question.Name)
+	name := strings.ToLower(owner)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	z := s.zoneContaining(name)
+	if z == nil {
+		msg.Rcode = dns.RcodeRefused
+		_ = w.WriteMsg(msg)
+		return
+	}
+
+	relative := "@"
+	if origin := dns.Fqdn(strings.ToLower(z.Name)); name != origin {
+		relative = strings.TrimSuffix(name, "."+origin)
+	}
+
+	exists := relative == "@"
+	if exists && question.Qtype == dns.TypeNS {
+		for _, ns := range z.Nameservers {
+			msg.Answer = append(msg.Answer, &dns.NS{
+				Hdr: dns.RR_Header{Name: owner, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: defaultDNSTtl},
+				Ns:  dns.Fqdn(ns),
+			})
+		}
+	}
+	for _, record := range z.records {
+		if !strings.EqualFold(record.Name, relative) {
+			continue
+		}
+		exists = true
+		if question.Qtype != dns.TypeANY && dns.StringToType[record.Type] != question.Qtype {
+			continue
+		}
+
+		ttl := record.Ttl
+		if ttl <= 0 {
+			ttl = defaultDNSTtl
+		}
+		rr, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", owner, ttl, record.Type, record.Value))
+		if err == nil && rr != nil {
+			msg.Answer = append(msg.Answer, rr)
+		}
+	}
+	if !exists {
+		msg.Rcode = dns.RcodeNameError
+	}
+
+	_ = w.WriteMsg(msg)
+}
+
+// zoneContaining returns the most specific zone containing the fully qualified name, or nil.
+func (s *Server) zoneContaining(name string) *zone {
+	var found *zone
+	for _, z := range s.zones {
+		origin := dns.Fqdn(strings.ToLower(z.Name))
+		if dns.IsSubDomain(origin, name) && (found == nil || len(z.Name) > len(found.Name)) {
+			found = z
+		}
+	}
+	return found
+}
@@ -0,0 +1,65 @@
+package hetznertest
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestServerDNS(t *testing.T) {
+	s := NewServer(t, testToken)
+	s.AddZone(Zone{Name: "example.com", Nameservers: []string{"hydrogen.ns.hetzner.com."}})
+	s.AddZone(Zone{Name: "sub.example.com"})
+	s.AddRecord("example.com", "_acme-challenge", "TXT", `"key1"`)
+	s.AddRecord("example.com", "_acme-challenge", "TXT", `"key2"`)
+	s.AddRecord("sub.example.com", "_acme-challenge", "TXT", `"key3"`)
+	s.AddRecord("example.com", "www", "A", "192.0.2.1")
+	address := s.StartDNS(t)
+
+	testCases := []struct {
+		name          string
+		qtype         uint16
+		expectedRcode int
+		expectedTxt   []string
+	}{
+		{"_acme-challenge.example.com.", dns.TypeTXT, dns.RcodeSuccess, []string{"key1", "key2"}},
+		{"_ACME-challenge.Sub.Example.com.", dns.TypeTXT, dns.RcodeSuccess, []string{"key3"}},
+		{"www.example.com.", dns.TypeTXT, dns.RcodeSuccess, nil},
+		{"missing.example.com.", dns.TypeTXT, dns.RcodeNameError, nil},
+		{"example.com.", dns.TypeTXT, dns.RcodeSuccess, nil},
+		{"example.org.", dns.TypeTXT, dns.RcodeRefused, nil},
+	}
+
+	client := &dns.Client{}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			msg := new(dns.Msg)
+			msg.SetQuestion(tc.name, tc.qtype)
+			in, _, err := client.Exchange(msg, address)
+			if err != nil {
+				t.Fatalf("Expected no error, but got: %v", err)
+			}
+			if in.Rcode != tc.expectedRcode {
+				t.Errorf("Expected rcode %s, but got %s", dns.RcodeToString[tc.expectedRcode], dns.RcodeToString[in.Rcode])
+			}
+
+			var txt []string
+			for _, rr := range in.Answer {
+				if record, ok := rr.(*dns.TXT); ok {
+					txt = append(txt, record.Txt...)
+				}
+			}
+			if !reflect.DeepEqual(txt, tc.expectedTxt) {
+				t.Errorf("Expected %v, but got %v", tc.expectedTxt, txt)
+			}
+		})
+	}
+
+	msg := new(dns.Msg)
+	msg.SetQuestion("example.com.", dns.TypeNS)
+	in, _, err := client.Exchange(msg, address)
+	if err != nil || len(in.Answer) != 1 {
+		t.Errorf("Expected one NS record, but got %v, %v", in, err)
+	}
+}
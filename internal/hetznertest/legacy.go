@@ -0,0 +1,160 @@
+package hetznertest
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/trijpstra-fourlights/cert-manager-webhook-hetzner/internal"
+)
+
+// legacyHandler serves the zones and records of the legacy DNS API, which stores every
+// value as a record of its own.
+func (s *Server) legacyHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /zones", s.legacyZones)
+	mux.HandleFunc("GET /zones/{id}", s.legacyZone)
+	mux.HandleFunc("GET /records", s.legacyRecords)
+	mux.HandleFunc("POST /records", s.legacyCreateRecord)
+	mux.HandleFunc("GET /records/{id}", s.legacyRecord)
+	mux.HandleFunc("DELETE /records/{id}", s.legacyDeleteRecord)
+	return mux
+}
+
+func legacyZone(z *zone) internal.Zone {
+	return internal.Zone{
+		Id:             strconv.FormatInt(z.id, 10),
+		Name:           z.Name,
+		Ns:             z.Nameservers,
+		Paused:         z.Paused,
+		IsSecondaryDns: z.Secondary,
+		Status:         "verified",
+		RecordsCount:   len(z.records),
+	}
+}
+
+func legacyRecord(z *zone, record *Record) internal.Record {
+	return internal.Record{
+		Type:   record.Type,
+		Id:     record.Id,
+		ZoneId: strconv.FormatInt(z.id, 10),
+		Name:   record.Name,
+		Value:  record.Value,
+		Ttl:    record.Ttl,
+	}
+}
+
+// findRecord returns the record with id and its zone, or nil.
+func (s *Server) findRecord(id string) (*zone, *Record) {
+	for _, z := range s.zones {
+		for _, record := range z.records {
+			if record.Id == id {
+				return z, record
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (s *Server) legacyZones(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	zones, meta := page(s, r, s.zonesNamed(r.URL.Query().Get("name")))
+	response := internal.ZoneResponse{Zones: []internal.Zone{}, Meta: meta}
+	for _, z := range zones {
+		response.Zones = append(response.Zones, legacyZone(z))
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) legacyZone(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	z := s.zoneById(r.PathValue("id"))
+	if z == nil {
+		writeError(w, http.StatusNotFound, "zone not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]internal.Zone{"zone": legacyZone(z)})
+}
+
+func (s *Server) legacyRecords(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	z := s.zoneById(r.URL.Query().Get("zone_id"))
+	if z == nil {
+		writeError(w, http.StatusNotFound, "zone not found")
+		return
+	}
+
+	// Like the API, all records are listed unless a page is requested
+	records, meta := z.records, internal.Meta{Pagination: internal.Pagination{Page: 1, PerPage: len(z.records), LastPage: 1, TotalEntries: len(z.records)}}
+	if r.URL.Query().Has("page") || r.URL.Query().Has("per_page") {
+		records, meta = page(s, r, z.records)
+	}
+	response := internal.RecordResponse{Records: []internal.Record{}, Meta: meta}
+	for _, record := range records {
+		response.Records = append(response.Records, legacyRecord(z, record))
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) legacyCreateRecord(w http.ResponseWriter, r *http.Request) {
+	var request internal.Record
+	if !decode(w, r, &request) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	z := s.zoneById(request.ZoneId)
+	switch {
+	case z == nil:
+		writeError(w, http.StatusNotFound, "zone not found")
+		return
+	case z.Secondary:
+		writeError(w, http.StatusUnprocessableEntity, "zone is a secondary zone")
+		return
+	case request.Name == "" || request.Type == "" || request.Value == "":
+		writeError(w, http.StatusUnprocessableEntity, "name, type and value are required")
+		return
+	}
+
+	record := s.addRecord(z, request.Name, request.Type, request.Value, request.Ttl)
+	created := legacyRecord(z, record)
+	created.Created = timestamp()
+	writeJSON(w, http.StatusOK, internal.RecordCreateResponse{Record: created})
+}
+
+func (s *Server) legacyRecord(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	z, record := s.findRecord(r.PathValue("id"))
+	if record == nil {
+		writeError(w, http.StatusNotFound, "record not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, internal.RecordCreateResponse{Record: legacyRecord(z, record)})
+}
+
+func (s *Server) legacyDeleteRecord(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	z, record := s.findRecord(r.PathValue("id"))
+	if record == nil {
+		writeError(w, http.StatusNotFound, "record not found")
+		return
+	}
+	if z.Secondary {
+		writeError(w, http.StatusUnprocessableEntity, "zone is a secondary zone")
+		return
+	}
+	z.records = slices.DeleteFunc(z.records, func(r *Record) bool { return r == record })
+	writeJSON(w, http.StatusOK, map[string]any{})
+}
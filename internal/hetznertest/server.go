@@ -0,0 +1,328 @@
+// Package hetznertest provides an in-memory fake of the legacy Hetzner DNS API and the
+// Hetzner Cloud DNS API, for testing the solver without network access or an account.
+package hetznertest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/trijpstra-fourlights/cert-manager-webhook-hetzner/internal"
+)
+
+const (
+	// LegacyPath and CloudPath are the paths the APIs are served at, see Server.URL.
+	LegacyPath = "/dns/api/v1"
+	CloudPath  = "/cloud/v1"
+
+	defaultPageSize = 100
+)
+
+// Zone is a zone of the fake.
+type Zone struct {
+	Name   string
+	Paused bool
+	// Secondary zones cannot be changed through the API.
+	Secondary bool
+	// Nameservers are the authoritative nameservers assigned to the zone.
+	Nameservers []string
+}
+
+// Record is a record of the fake. The Cloud API groups the records of a name and type
+// into an rrset.
+type Record struct {
+	Id   string
+	Name string
+	Type string
+	// Value is the presentation form as stored by the API, quoted for TXT records.
+	Value string
+	Ttl   int
+}
+
+// Fault makes matching requests fail instead of being served.
+type Fault struct {
+	// Flavor is internal.ApiFlavorLegacy or internal.ApiFlavorCloud, empty matches both.
+	Flavor string
+	// Method matches any method when empty.
+	Method string
+	// Path is a prefix of the path relative to the API, e.g. /records; empty matches
+	// any path.
+	Path string
+	// Status is answered to matching requests, with the Retry-After header for
+	// 429 Too Many Requests.
+	Status     int
+	RetryAfter string
+	// Times is the number of requests failed, 1 when not set.
+	Times int
+}
+
+// Request is a request served by the fake.
+type Request struct {
+	Flavor, Method, Path string
+}
+
+// Server serves the fake APIs, sharing their zones and records. Requests need the token
+// of the server, as bearer token or, for the legacy API, the Auth-API-Token header.
+type Server struct {
+	// PageSize is the maximum number of entries per page, 100 when not set.
+	PageSize int
+	// ActionPolls is the number of times a Cloud API action is reported running before
+	// it succeeds.
+	ActionPolls int
+
+	server *httptest.Server
+	token  string
+
+	mu       sync.Mutex
+	nextId   int64
+	zones    []*zone
+	faults   []*Fault
+	requests []Request
+	actions  map[int64]*action
+}
+
+type zone struct {
+	Zone
+	id      int64
+	records []*Record
+	// labels of the Cloud API rrsets by name and type
+	labels map[string]map[string]string
+}
+
+type action struct {
+	internal.CloudAction
+	polls int
+}
+
+// NewServer starts a fake accepting token, closed when the test finishes.
+func NewServer(t testing.TB, token string) *Server {
+	s := &Server{token: token, actions: map[int64]*action{}}
+
+	mux := http.NewServeMux()
+	mux.Handle(LegacyPath+"/", http.StripPrefix(LegacyPath, s.api(internal.ApiFlavorLegacy, s.legacyHandler())))
+	mux.Handle(CloudPath+"/", http.StripPrefix(CloudPath, s.api(internal.ApiFlavorCloud, s.cloudHandler())))
+	s.server = httptest.NewServer(mux)
+	t.Cleanup(s.server.Close)
+
+	return s
+}
+
+// URL returns the API URL of flavor, as used for apiUrl in the solver config.
+func (s *Server) URL(flavor string) string {
+	if flavor == internal.ApiFlavorCloud {
+		return s.server.URL + CloudPath
+	}
+	return s.server.URL + LegacyPath
+}
+
+// AddZone adds zone and returns its id.
+func (s *Server) AddZone(z Zone) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextId++
+	s.zones = append(s.zones, &zone{Zone: z, id: s.nextId, labels: map[string]map[string]string{}})
+	return strconv.FormatInt(s.nextId, 10)
+}
+
+// AddRecord adds a record with the value in presentation form to the zone zoneName.
+func (s *Server) AddRecord(zoneName, name, recordType, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	z := s.zoneByName(zoneName)
+	if z == nil {
+		panic("hetznertest: unknown zone " + zoneName)
+	}
+	s.addRecord(z, name, recordType, value, 0)
+}
+
+// Records returns the records of the zone zoneName.
+func (s *Server) Records(zoneName string) []Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var records []Record
+	if z := s.zoneByName(zoneName); z != nil {
+		for _, record := range z.records {
+			records = append(records, *record)
+		}
+	}
+	return records
+}
+
+// TXT returns the sorted, decoded TXT values at name in the zone zoneName.
+func (s *Server) TXT(zoneName, name string) []string {
+	var values []string
+	for _, record := range s.Records(zoneName) {
+		if record.Type == "TXT" && record.Name == name {
+			values = append(values, internal.DecodeTxt(record.Value))
+		}
+	}
+	slices.Sort(values)
+	return values
+}
+
+// Inject adds fault, applied to the following requests until it was used up.
+func (s *Server) Inject(fault Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if fault.Times <= 0 {
+		fault.Times = 1
+	}
+	s.faults = append(s.faults, &fault)
+}
+
+// Requests returns the requests served so far, including failed ones.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.requests)
+}
+
+// api logs requests to the API of flavor, applies faults and checks the token before
+// serving them with handler.
+func (s *Server) api(flavor string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, Request{Flavor: flavor, Method: r.Method, Path: r.URL.Path})
+		fault := s.fault(flavor, r)
+		s.mu.Unlock()
+
+		if fault != nil {
+			if fault.RetryAfter != "" {
+				w.Header().Set("Retry-After", fault.RetryAfter)
+			}
+			writeError(w, fault.Status, "injected fault")
+			return
+		}
+
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if flavor == internal.ApiFlavorLegacy && r.Header.Get("Auth-API-Token") != "" {
+			token = r.Header.Get("Auth-API-Token")
+		}
+		if token != s.token {
+			writeError(w, http.StatusUnauthorized, "invalid token")
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// fault returns the first fault matching r and uses it up.
+func (s *Server) fault(flavor string, r *http.Request) *Fault {
+	for i, fault := range s.faults {
+		if (fault.Flavor == "" || fault.Flavor == flavor) &&
+			(fault.Method == "" || fault.Method == r.Method) &&
+			strings.HasPrefix(r.URL.Path, fault.Path) {
+			fault.Times--
+			if fault.Times == 0 {
+				s.faults = slices.Delete(s.faults, i, i+1)
+			}
+			return fault
+		}
+	}
+	return nil
+}
+
+// zoneByName returns the zone name, or nil.
+func (s *Server) zoneByName(name string) *zone {
+	for _, z := range s.zones {
+		if internal.EqualDomain(z.Name, name) {
+			return z
+		}
+	}
+	return nil
+}
+
+// zoneById returns the zone with id, or with the name id, or nil.
+func (s *Server) zoneById(id string) *zone {
+	for _, z := range s.zones {
+		if strconv.FormatInt(z.id, 10) == id {
+			return z
+		}
+	}
+	return s.zoneByName(id)
+}
+
+// zonesNamed returns the zones named name, or all zones when name is empty.
+func (s *Server) zonesNamed(name string) []*zone {
+	if name == "" {
+		return s.zones
+	}
+	if z := s.zoneByName(name); z != nil {
+		return []*zone{z}
+	}
+	return nil
+}
+
+func (s *Server) addRecord(z *zone, name, recordType, value string, ttl int) *Record {
+	s.nextId++
+	record := &Record{Id: "record-" + strconv.FormatInt(s.nextId, 10), Name: name, Type: recordType, Value: value, Ttl: ttl}
+	z.records = append(z.records, record)
+	return record
+}
+
+// page returns the entries of page of items as requested by r, and the pagination meta
+// data.
+func page[T any](s *Server, r *http.Request, items []T) ([]T, internal.Meta) {
+	perPage := s.PageSize
+	if perPage <= 0 {
+		perPage = defaultPageSize
+	}
+	if requested, err := strconv.Atoi(r.URL.Query().Get("per_page")); err == nil && requested > 0 && requested < perPage {
+		perPage = requested
+	}
+	current, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || current < 1 {
+		current = 1
+	}
+
+	lastPage := max((len(items)+perPage-1)/perPage, 1)
+	start := min((current-1)*perPage, len(items))
+	end := min(start+perPage, len(items))
+	return items[start:end], internal.Meta{Pagination: internal.Pagination{
+		Page:         current,
+		PerPage:      perPage,
+		LastPage:     lastPage,
+		TotalEntries: len(items),
+	}}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// writeError answers with status and an error body in the format of the Cloud API, which
+// the legacy API also understands as a message.
+func writeError(w http.ResponseWriter, status int, message string) {
+	code := strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+	writeJSON(w, status, map[string]any{
+		"error":   map[string]string{"code": code, "message": message},
+		"message": message,
+	})
+}
+
+func decode(w http.ResponseWriter, r *http.Request, body any) bool {
+	if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid body: %v", err))
+		return false
+	}
+	return true
+}
+
+func timestamp() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
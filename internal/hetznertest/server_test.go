@@ -0,0 +1,192 @@
+package hetznertest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/trijpstra-fourlights/cert-manager-webhook-hetzner/internal"
+)
+
+const testToken = "test-token"
+
+// call sends a request to the API of flavor and decodes the response into out, if set.
+func call(t *testing.T, s *Server, flavor, method, path, token, body string, out any) int {
+	t.Helper()
+
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(method, s.URL(flavor)+path, reader)
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	defer resp.Body.Close()
+	if out != nil && resp.StatusCode < 300 {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("Expected a JSON response, but got: %v", err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestServerAuth(t *testing.T) {
+	s := NewServer(t, testToken)
+
+	testCases := []struct {
+		flavor   string
+		token    string
+		expected int
+	}{
+		{internal.ApiFlavorLegacy, testToken, http.StatusOK},
+		{internal.ApiFlavorLegacy, "wrong", http.StatusUnauthorized},
+		{internal.ApiFlavorCloud, testToken, http.StatusOK},
+		{internal.ApiFlavorCloud, "", http.StatusUnauthorized},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s %q", tc.flavor, tc.token), func(t *testing.T) {
+			if status := call(t, s, tc.flavor, http.MethodGet, "/zones", tc.token, "", nil); status != tc.expected {
+				t.Errorf("Expected status %d, but got %d", tc.expected, status)
+			}
+		})
+	}
+}
+
+func TestServerZonesPagination(t *testing.T) {
+	s := NewServer(t, testToken)
+	s.PageSize = 2
+	for _, name := range []string{"a.com", "b.com", "c.com"} {
+		s.AddZone(Zone{Name: name})
+	}
+
+	var first, last internal.ZoneResponse
+	call(t, s, internal.ApiFlavorLegacy, http.MethodGet, "/zones?per_page=100", testToken, "", &first)
+	call(t, s, internal.ApiFlavorLegacy, http.MethodGet, "/zones?page=2", testToken, "", &last)
+	if len(first.Zones) != 2 || len(last.Zones) != 1 || last.Zones[0].Name != "c.com" {
+		t.Errorf("Unexpected pages %+v and %+v", first.Zones, last.Zones)
+	}
+	if first.Meta.Pagination.LastPage != 2 || first.Meta.Pagination.TotalEntries != 3 {
+		t.Errorf("Unexpected pagination %+v", first.Meta.Pagination)
+	}
+
+	var named internal.CloudZoneResponse
+	call(t, s, internal.ApiFlavorCloud, http.MethodGet, "/zones?name=b.com", testToken, "", &named)
+	if len(named.Zones) != 1 || named.Zones[0].Name != "b.com" || named.Zones[0].Mode != "primary" {
+		t.Errorf("Unexpected zones %+v", named.Zones)
+	}
+}
+
+func TestServerLegacyRecords(t *testing.T) {
+	s := NewServer(t, testToken)
+	zoneId := s.AddZone(Zone{Name: "example.com"})
+
+	var created internal.RecordCreateResponse
+	body := fmt.Sprintf(`{"value":"\"key1\"","ttl":120,"type":"TXT","name":"_acme-challenge","zone_id":%q}`, zoneId)
+	if status := call(t, s, internal.ApiFlavorLegacy, http.MethodPost, "/records", testToken, body, &created); status != http.StatusOK {
+		t.Fatalf("Expected status 200, but got %d", status)
+	}
+	if values := s.TXT("example.com", "_acme-challenge"); !reflect.DeepEqual(values, []string{"key1"}) {
+		t.Errorf("Expected [key1], but got %v", values)
+	}
+
+	var records internal.RecordResponse
+	call(t, s, internal.ApiFlavorLegacy, http.MethodGet, "/records?zone_id="+zoneId, testToken, "", &records)
+	if len(records.Records) != 1 || records.Records[0].Id != created.Record.Id {
+		t.Errorf("Unexpected records %+v", records.Records)
+	}
+
+	if status := call(t, s, internal.ApiFlavorLegacy, http.MethodDelete, "/records/"+created.Record.Id, testToken, "", nil); status != http.StatusOK {
+		t.Errorf("Expected status 200, but got %d", status)
+	}
+	if status := call(t, s, internal.ApiFlavorLegacy, http.MethodDelete, "/records/"+created.Record.Id, testToken, "", nil); status != http.StatusNotFound {
+		t.Errorf("Expected status 404, but got %d", status)
+	}
+}
+
+func TestServerCloudRRSets(t *testing.T) {
+	s := NewServer(t, testToken)
+	s.ActionPolls = 1
+	zoneId := s.AddZone(Zone{Name: "example.com"})
+	rrset := "/zones/" + zoneId + "/rrsets/_acme-challenge/TXT"
+
+	var created internal.CloudActionResponse
+	body := `{"name":"_acme-challenge","type":"TXT","ttl":120,"labels":{"cluster-id":"test"},"records":[{"value":"\"key1\""}]}`
+	if status := call(t, s, internal.ApiFlavorCloud, http.MethodPost, "/zones/"+zoneId+"/rrsets", testToken, body, &created); status != http.StatusCreated {
+		t.Fatalf("Expected status 201, but got %d", status)
+	}
+	if status := call(t, s, internal.ApiFlavorCloud, http.MethodPost, "/zones/"+zoneId+"/rrsets", testToken, body, nil); status != http.StatusConflict {
+		t.Errorf("Expected status 409, but got %d", status)
+	}
+	call(t, s, internal.ApiFlavorCloud, http.MethodPost, rrset+"/actions/add_records", testToken, `{"records":[{"value":"\"key2\""}]}`, nil)
+
+	if created.Action == nil || created.Action.Status != internal.ActionStatusRunning {
+		t.Fatalf("Expected a running action, but got %+v", created.Action)
+	}
+	var polled internal.CloudActionResponse
+	call(t, s, internal.ApiFlavorCloud, http.MethodGet, fmt.Sprintf("/zones/actions/%d", created.Action.Id), testToken, "", &polled)
+	if polled.Action == nil || polled.Action.Status != internal.ActionStatusSuccess {
+		t.Errorf("Expected a successful action, but got %+v", polled.Action)
+	}
+
+	var got internal.CloudRRSetResponse
+	call(t, s, internal.ApiFlavorCloud, http.MethodGet, rrset, testToken, "", &got)
+	if len(got.RRSet.Records) != 2 || got.RRSet.Labels["cluster-id"] != "test" {
+		t.Errorf("Unexpected rrset %+v", got.RRSet)
+	}
+
+	call(t, s, internal.ApiFlavorCloud, http.MethodPost, rrset+"/actions/remove_records", testToken, `{"records":[{"value":"\"key1\""},{"value":"\"key2\""}]}`, nil)
+	if status := call(t, s, internal.ApiFlavorCloud, http.MethodGet, rrset, testToken, "", nil); status != http.StatusNotFound {
+		t.Errorf("Expected the empty rrset to be deleted, but got status %d", status)
+	}
+}
+
+func TestServerSecondaryZone(t *testing.T) {
+	s := NewServer(t, testToken)
+	zoneId := s.AddZone(Zone{Name: "example.com", Secondary: true})
+
+	body := fmt.Sprintf(`{"value":"\"key1\"","ttl":120,"type":"TXT","name":"_acme-challenge","zone_id":%q}`, zoneId)
+	if status := call(t, s, internal.ApiFlavorLegacy, http.MethodPost, "/records", testToken, body, nil); status != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422, but got %d", status)
+	}
+	if status := call(t, s, internal.ApiFlavorCloud, http.MethodPost, "/zones/"+zoneId+"/rrsets/_acme-challenge/TXT/actions/add_records", testToken, `{"records":[{"value":"\"key1\""}]}`, nil); status != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422, but got %d", status)
+	}
+}
+
+func TestServerFaults(t *testing.T) {
+	s := NewServer(t, testToken)
+	s.Inject(Fault{Flavor: internal.ApiFlavorCloud, Method: http.MethodGet, Path: "/zones", Status: http.StatusTooManyRequests, RetryAfter: "1", Times: 2})
+	s.Inject(Fault{Path: "/records", Status: http.StatusInternalServerError})
+
+	expected := []struct {
+		flavor, path string
+		status       int
+	}{
+		{internal.ApiFlavorLegacy, "/zones", http.StatusOK},
+		{internal.ApiFlavorCloud, "/zones", http.StatusTooManyRequests},
+		{internal.ApiFlavorCloud, "/zones", http.StatusTooManyRequests},
+		{internal.ApiFlavorCloud, "/zones", http.StatusOK},
+		{internal.ApiFlavorLegacy, "/records?zone_id=1", http.StatusInternalServerError},
+		{internal.ApiFlavorLegacy, "/records?zone_id=1", http.StatusNotFound},
+	}
+	for i, e := range expected {
+		if status := call(t, s, e.flavor, http.MethodGet, e.path, testToken, "", nil); status != e.status {
+			t.Errorf("Expected status %d for request %d, but got %d", e.status, i, status)
+		}
+	}
+	if requests := s.Requests(); len(requests) != len(expected) {
+		t.Errorf("Expected %d requests, but got %d", len(expected), len(requests))
+	}
+}
@@ -0,0 +1,46 @@
+package internal
+
+import (
+	"sync"
+)
+
+// KeyedMutex provides mutual exclusion per key, e.g. per zone and record name, without
+// serializing operations on unrelated keys. The zero value is ready to use.
+type KeyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	sync.Mutex
+	// refs counts the holders and waiters of the lock, it is removed once unused.
+	refs int
+}
+
+// Lock acquires the lock of key and returns the function releasing it.
+func (m *KeyedMutex) Lock(key string) (unlock func()) {
+	m.mu.Lock()
+	if m.locks == nil {
+		m.locks = map[string]*keyLock{}
+	}
+	lock, ok := m.locks[key]
+	if !ok {
+		lock = &keyLock{}
+		m.locks[key] = lock
+	}
+	lock.refs++
+	m.mu.Unlock()
+
+	lock.Lock()
+
+	return func() {
+		lock.Unlock()
+
+		m.mu.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(m.locks, key)
+		}
+		m.mu.Unlock()
+	}
+}
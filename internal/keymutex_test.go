@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKeyedMutexSerializesSameKey(t *testing.T) {
+	var m KeyedMutex
+	var wg sync.WaitGroup
+	active, maxActive := 0, 0
+	var counter sync.Mutex
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := m.Lock("example.com/_acme-challenge")
+			defer unlock()
+
+			counter.Lock()
+			active++
+			maxActive = max(maxActive, active)
+			counter.Unlock()
+
+			time.Sleep(time.Millisecond)
+
+			counter.Lock()
+			active--
+			counter.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if maxActive != 1 {
+		t.Errorf("Expected at most 1 concurrent holder, but got %d", maxActive)
+	}
+	if len(m.locks) != 0 {
+		t.Errorf("Expected unused locks to be removed, but got %d", len(m.locks))
+	}
+}
+
+func TestKeyedMutexIndependentKeys(t *testing.T) {
+	var m KeyedMutex
+	unlock := m.Lock("example.com/_acme-challenge")
+	defer unlock()
+
+	done := make(chan struct{})
+	go func() {
+		m.Lock("example.com/_acme-challenge.www")()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected a different key not to be blocked")
+	}
+}
@@ -0,0 +1,199 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+const leaseRetryInterval = 500 * time.Millisecond
+
+// LeaseLocker serializes writes to a record across webhook replicas using short-lived
+// Kubernetes Leases, one per key.
+type LeaseLocker struct {
+	client    kubernetes.Interface
+	namespace string
+	identity  string
+	duration  time.Duration
+}
+
+func NewLeaseLocker(client kubernetes.Interface, namespace, identity string, duration time.Duration) *LeaseLocker {
+	return &LeaseLocker{client: client, namespace: namespace, identity: identity, duration: duration}
+}
+
+// leaseName returns the name of the Lease guarding key.
+func leaseName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "hetzner-record-" + hex.EncodeToString(sum[:10])
+}
+
+// Lock acquires the Lease of key, waiting until it is released or expired, and returns the
+// function releasing it. The Lease is renewed every third of its duration until released.
+// It fails when ctx is done before the Lease could be acquired.
+func (l *LeaseLocker) Lock(ctx context.Context, key string) (unlock func(), err error) {
+	name := leaseName(key)
+	for {
+		acquired, err := l.tryAcquire(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if acquired {
+			klog.FromContext(ctx).V(4).Info("Acquired lease", "lease", name, "key", key)
+			stop := make(chan struct{})
+			stopped := make(chan struct{})
+			go func() {
+				defer close(stopped)
+				l.renew(name, stop)
+			}()
+			var once sync.Once
+			return func() {
+				once.Do(func() {
+					close(stop)
+					<-stopped
+					l.release(name)
+				})
+			}, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("unable to acquire lease `%s` for `%s`; %v", name, key, ctx.Err())
+		case <-time.After(leaseRetryInterval):
+		}
+	}
+}
+
+// tryAcquire creates the Lease, or takes it over once its holder let it expire.
+func (l *LeaseLocker) tryAcquire(ctx context.Context, name string) (bool, error) {
+	leases := l.client.CoordinationV1().Leases(l.namespace)
+	now := metav1.NewMicroTime(time.Now())
+	seconds := int32(l.duration.Seconds())
+
+	lease := &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: l.namespace},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &l.identity,
+			LeaseDurationSeconds: &seconds,
+			AcquireTime:          &now,
+			RenewTime:            &now,
+		},
+	}
+	_, err := leases.Create(ctx, lease, metav1.CreateOptions{})
+	if err == nil {
+		return true, nil
+	}
+	if !apierrors.IsAlreadyExists(err) {
+		return false, fmt.Errorf("unable to create lease `%s`; %v", name, err)
+	}
+
+	existing, err := leases.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		// Released in the meantime, try again
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("unable to get lease `%s`; %v", name, err)
+	}
+	if !leaseExpired(existing, now.Time) {
+		return false, nil
+	}
+
+	klog.FromContext(ctx).Info("Taking over expired lease", "lease", name, "holder", stringValue(existing.Spec.HolderIdentity))
+	existing.Spec = lease.Spec
+	_, err = leases.Update(ctx, existing, metav1.UpdateOptions{})
+	if apierrors.IsConflict(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("unable to update lease `%s`; %v", name, err)
+	}
+
+	return true, nil
+}
+
+// renew extends the Lease every third of its duration until stop is closed, or until it
+// was taken over by another replica.
+func (l *LeaseLocker) renew(name string, stop <-chan struct{}) {
+	interval := l.duration / 3
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	leases := l.client.CoordinationV1().Leases(l.namespace)
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		existing, err := leases.Get(ctx, name, metav1.GetOptions{})
+		if err == nil && stringValue(existing.Spec.HolderIdentity) != l.identity {
+			cancel()
+			klog.InfoS("Lease was taken over, no longer renewing it", "lease", name, "holder", stringValue(existing.Spec.HolderIdentity))
+			return
+		}
+		if err == nil {
+			now := metav1.NewMicroTime(time.Now())
+			existing.Spec.RenewTime = &now
+			_, err = leases.Update(ctx, existing, metav1.UpdateOptions{})
+		}
+		cancel()
+		if err != nil {
+			klog.ErrorS(err, "Unable to renew lease", "lease", name)
+		}
+	}
+}
+
+// release deletes the Lease if it is still held by this replica.
+func (l *LeaseLocker) release(name string) {
+	leases := l.client.CoordinationV1().Leases(l.namespace)
+	ctx := context.Background()
+
+	existing, err := leases.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			klog.ErrorS(err, "Unable to get lease for release", "lease", name)
+		}
+		return
+	}
+	if stringValue(existing.Spec.HolderIdentity) != l.identity {
+		klog.InfoS("Lease was taken over, not releasing it", "lease", name, "holder", stringValue(existing.Spec.HolderIdentity))
+		return
+	}
+
+	err = leases.Delete(ctx, name, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{ResourceVersion: &existing.ResourceVersion},
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		klog.ErrorS(err, "Unable to release lease", "lease", name)
+	}
+}
+
+func leaseExpired(lease *coordinationv1.Lease, now time.Time) bool {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	expiry := lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+
+	return now.After(expiry)
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
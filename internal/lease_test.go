@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestLeaseLocker(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	first := NewLeaseLocker(client, "cert-manager", "replica-1", time.Minute)
+	second := NewLeaseLocker(client, "cert-manager", "replica-2", time.Minute)
+	key := "example.com/_acme-challenge"
+
+	unlock, err := first.Lock(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := second.Lock(ctx, key); err == nil {
+		t.Fatal("Expected the lease held by another replica not to be acquired")
+	}
+
+	unlocked, err := second.Lock(context.Background(), "example.com/_acme-challenge.www")
+	if err != nil {
+		t.Fatalf("Expected a different key to be acquired, but got: %v", err)
+	}
+	unlocked()
+
+	unlock()
+	unlock, err = second.Lock(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Expected the released lease to be acquired, but got: %v", err)
+	}
+	unlock()
+
+	leases, _ := client.CoordinationV1().Leases("cert-manager").List(context.Background(), metav1.ListOptions{})
+	if len(leases.Items) != 0 {
+		t.Errorf("Expected all leases to be released, but got %d", len(leases.Items))
+	}
+}
+
+func TestLeaseLockerTakesOverExpiredLease(t *testing.T) {
+	key := "example.com/_acme-challenge"
+	holder := "crashed-replica"
+	seconds := int32(10)
+	renewed := metav1.NewMicroTime(time.Now().Add(-time.Minute))
+	client := fake.NewSimpleClientset(&coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: leaseName(key), Namespace: "cert-manager"},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &holder,
+			LeaseDurationSeconds: &seconds,
+			RenewTime:            &renewed,
+		},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	unlock, err := NewLeaseLocker(client, "cert-manager", "replica-1", time.Minute).Lock(ctx, key)
+	if err != nil {
+		t.Fatalf("Expected the expired lease to be taken over, but got: %v", err)
+	}
+	unlock()
+}
+
+func TestLeaseLockerRenewsHeldLease(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	key := "example.com/_acme-challenge"
+	unlock, err := NewLeaseLocker(client, "cert-manager", "replica-1", 1500*time.Millisecond).Lock(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	defer unlock()
+
+	leases := client.CoordinationV1().Leases("cert-manager")
+	acquired, _ := leases.Get(context.Background(), leaseName(key), metav1.GetOptions{})
+	time.Sleep(1200 * time.Millisecond)
+	renewed, _ := leases.Get(context.Background(), leaseName(key), metav1.GetOptions{})
+	if !renewed.Spec.RenewTime.After(acquired.Spec.RenewTime.Time) {
+		t.Errorf("Expected the lease to be renewed after %v, but got %v", acquired.Spec.RenewTime, renewed.Spec.RenewTime)
+	}
+	if leaseExpired(renewed, time.Now()) {
+		t.Error("Expected the held lease not to expire")
+	}
+}
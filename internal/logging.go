@@ -0,0 +1,179 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-logr/logr"
+	"k8s.io/klog/v2"
+)
+
+// minSecretLength is the length below which values are not registered as secrets, as
+// redacting them would mangle unrelated log output. API tokens are much longer.
+const minSecretLength = 6
+
+const redacted = "[REDACTED]"
+
+var (
+	secretsMu sync.RWMutex
+	secrets   = map[string]bool{}
+	replacer  = strings.NewReplacer()
+
+	// credentialPatterns match credentials that were never registered, like tokens in
+	// request headers dumped by a library.
+	credentialPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)(\bbearer\s+)[^\s"',]+`),
+		regexp.MustCompile(`(?i)(\bauth-api-token"?\s*[:=]\s*"?)[^\s"',]+`),
+	}
+)
+
+// RegisterSecret makes Redact remove value from all log output from now on.
+func RegisterSecret(value string) {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+
+	added := false
+	for _, v := range []string{value, strings.TrimSpace(value)} {
+		if len(v) >= minSecretLength && !secrets[v] {
+			secrets[v] = true
+			added = true
+		}
+	}
+	if !added {
+		return
+	}
+
+	// Longer secrets first, so that a secret containing another is redacted as a whole
+	values := make([]string, 0, len(secrets))
+	for v := range secrets {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	oldnew := make([]string, 0, 2*len(values))
+	for _, v := range values {
+		oldnew = append(oldnew, v, redacted)
+	}
+	replacer = strings.NewReplacer(oldnew...)
+}
+
+// Redact returns s with registered secrets and credentials replaced.
+func Redact(s string) string {
+	secretsMu.RLock()
+	r := replacer
+	secretsMu.RUnlock()
+
+	s = r.Replace(s)
+	for _, pattern := range credentialPatterns {
+		s = pattern.ReplaceAllString(s, "${1}"+redacted)
+	}
+	return s
+}
+
+// redactValue returns v, or its redacted text when its text contains a secret.
+func redactValue(v interface{}) interface{} {
+	var text string
+	switch value := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return Redact(value)
+	case error:
+		text = value.Error()
+	case fmt.Stringer:
+		text = value.String()
+	default:
+		text = fmt.Sprintf("%+v", value)
+	}
+
+	if safe := Redact(text); safe != text {
+		return safe
+	}
+	return v
+}
+
+func redactValues(values []interface{}) []interface{} {
+	safe := make([]interface{}, len(values))
+	for i, v := range values {
+		safe[i] = redactValue(v)
+	}
+	return safe
+}
+
+// LogRedactor is a klog filter removing secrets from the messages and values of all klog
+// calls.
+type LogRedactor struct{}
+
+var _ klog.LogFilter = LogRedactor{}
+
+func (LogRedactor) Filter(args []interface{}) []interface{} {
+	return redactValues(args)
+}
+
+func (LogRedactor) FilterF(format string, args []interface{}) (string, []interface{}) {
+	text := fmt.Sprintf(format, args...)
+	if safe := Redact(text); safe != text {
+		return "%s", []interface{}{safe}
+	}
+	return format, args
+}
+
+func (LogRedactor) FilterS(msg string, keysAndValues []interface{}) (string, []interface{}) {
+	return Redact(msg), redactValues(keysAndValues)
+}
+
+// NewLogger returns the klog logger with secrets redacted from its messages, values and
+// errors. The klog filter does not see the errors passed to structured error logs.
+func NewLogger() klog.Logger {
+	sink := klog.Background().GetSink()
+	if withDepth, ok := sink.(logr.CallDepthLogSink); ok {
+		// Skip the frame of redactingSink
+		sink = withDepth.WithCallDepth(1)
+	}
+	return logr.New(&redactingSink{sink: sink})
+}
+
+// redactingSink redacts secrets before passing log entries to sink.
+type redactingSink struct {
+	sink logr.LogSink
+}
+
+var _ logr.CallDepthLogSink = &redactingSink{}
+
+// Init does nothing, the wrapped sink was initialized by its own logger.
+func (s *redactingSink) Init(logr.RuntimeInfo) {}
+
+func (s *redactingSink) Enabled(level int) bool {
+	return s.sink.Enabled(level)
+}
+
+func (s *redactingSink) Info(level int, msg string, keysAndValues ...interface{}) {
+	s.sink.Info(level, Redact(msg), redactValues(keysAndValues)...)
+}
+
+func (s *redactingSink) Error(err error, msg string, keysAndValues ...interface{}) {
+	if err != nil {
+		if text := err.Error(); Redact(text) != text {
+			err = errors.New(Redact(text))
+		}
+	}
+	s.sink.Error(err, Redact(msg), redactValues(keysAndValues)...)
+}
+
+func (s *redactingSink) WithValues(keysAndValues ...interface{}) logr.LogSink {
+	return &redactingSink{sink: s.sink.WithValues(redactValues(keysAndValues)...)}
+}
+
+func (s *redactingSink) WithName(name string) logr.LogSink {
+	return &redactingSink{sink: s.sink.WithName(name)}
+}
+
+func (s *redactingSink) WithCallDepth(depth int) logr.LogSink {
+	if sink, ok := s.sink.(logr.CallDepthLogSink); ok {
+		return &redactingSink{sink: sink.WithCallDepth(depth)}
+	}
+	return s
+}
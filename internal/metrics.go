@@ -0,0 +1,136 @@
+package internal
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "cert_manager_webhook_hetzner"
+
+var (
+	// MetricsRegistry holds the metrics of the webhook, served by MetricsHandler.
+	MetricsRegistry = prometheus.NewRegistry()
+
+	operationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "operations_total",
+		Help:      "Number of Present and CleanUp calls by zone and result.",
+	}, []string{"operation", "zone", "result"})
+
+	operationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "operation_duration_seconds",
+		Help:      "Duration of Present and CleanUp calls by zone and result.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"operation", "zone", "result"})
+
+	apiRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "api_requests_total",
+		Help:      "Number of Hetzner API requests by method, endpoint and status code.",
+	}, []string{"method", "endpoint", "code"})
+
+	apiRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "api_request_duration_seconds",
+		Help:      "Duration of Hetzner API requests by method and endpoint.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "endpoint"})
+
+	zoneCacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "zone_cache_lookups_total",
+		Help:      "Number of zone id lookups by result, hit or miss.",
+	}, []string{"result"})
+
+	apiThrottleWaits = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "api_throttle_waits_total",
+		Help:      "Number of times a Hetzner API request was rate limited and retried.",
+	})
+
+	apiThrottleWaitSeconds = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "api_throttle_wait_seconds_total",
+		Help:      "Time spent waiting for Hetzner API rate limits.",
+	})
+)
+
+func init() {
+	MetricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		operationsTotal,
+		operationDuration,
+		apiRequestsTotal,
+		apiRequestDuration,
+		zoneCacheLookups,
+		apiThrottleWaits,
+		apiThrottleWaitSeconds,
+	)
+}
+
+// MetricsHandler serves the metrics of MetricsRegistry.
+func MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(MetricsRegistry, promhttp.HandlerOpts{Registry: MetricsRegistry})
+}
+
+// ObserveOperation records a Present or CleanUp call on zone that started at start and
+// ended with err.
+func ObserveOperation(operation, zone string, start time.Time, err error) {
+	if zone == "" {
+		zone = "unknown"
+	}
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+
+	operationsTotal.WithLabelValues(operation, zone, result).Inc()
+	operationDuration.WithLabelValues(operation, zone, result).Observe(time.Since(start).Seconds())
+}
+
+// ObserveAPIRequest records a request to the Hetzner API path that started at start and
+// was answered with code, 0 when no response was received.
+func ObserveAPIRequest(method, path string, code int, start time.Time) {
+	endpoint := EndpointLabel(path)
+	status := strconv.Itoa(code)
+	if code == 0 {
+		status = "none"
+	}
+
+	apiRequestsTotal.WithLabelValues(method, endpoint, status).Inc()
+	apiRequestDuration.WithLabelValues(method, endpoint).Observe(time.Since(start).Seconds())
+}
+
+// ObserveThrottleWait records a wait of d for a rate limited API request.
+func ObserveThrottleWait(d time.Duration) {
+	apiThrottleWaits.Inc()
+	apiThrottleWaitSeconds.Add(d.Seconds())
+}
+
+// endpointSegments are the path segments of the Hetzner APIs kept in endpoint labels, all
+// others are ids or names.
+var endpointSegments = map[string]bool{
+	"api": true, "v1": true, "zones": true, "records": true, "rrsets": true, "actions": true,
+	"add_records": true, "remove_records": true, "TXT": true,
+}
+
+// EndpointLabel returns path with ids and names replaced by placeholders, so that the
+// number of endpoint label values stays bounded.
+func EndpointLabel(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, segment := range segments {
+		if !endpointSegments[segment] {
+			segments[i] = "{id}"
+		}
+	}
+
+	return "/" + strings.Join(segments, "/")
+}
@@ -0,0 +1,22 @@
+package internal
+
+import "testing"
+
+func TestEndpointLabel(t *testing.T) {
+	testCases := []struct {
+		path     string
+		expected string
+	}{
+		{"/api/v1/zones", "/api/v1/zones"},
+		{"/api/v1/records/2a7d4b0c8f", "/api/v1/records/{id}"},
+		{"/v1/zones/42/rrsets/_acme-challenge.www/TXT", "/v1/zones/{id}/rrsets/{id}/TXT"},
+		{"/v1/zones/42/rrsets/_acme-challenge/TXT/actions/add_records", "/v1/zones/{id}/rrsets/{id}/TXT/actions/add_records"},
+		{"/v1/zones/actions/1337", "/v1/zones/actions/{id}"},
+	}
+
+	for _, tc := range testCases {
+		if label := EndpointLabel(tc.path); label != tc.expected {
+			t.Errorf("Expected endpoint %s for %s, but got %s", tc.expected, tc.path, label)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+// OwnedRecord describes a TXT record created by the webhook.
+type OwnedRecord struct {
+	// ClusterId identifies the cluster whose webhook created the record.
+	ClusterId string    `json:"clusterId,omitempty"`
+	ZoneId    string    `json:"zoneId"`
+	ZoneName  string    `json:"zoneName"`
+	RecordId  string    `json:"recordId"`
+	Name      string    `json:"name"`
+	Value     string    `json:"value"`
+	Created   time.Time `json:"created"`
+	// ApiUrl and the secret reference allow background jobs to reach the zone again.
+	ApiUrl          string `json:"apiUrl"`
+	ApiFlavor       string `json:"apiFlavor,omitempty"`
+	SecretNamespace string `json:"secretNamespace"`
+	SecretName      string `json:"secretName"`
+	SecretKey       string `json:"secretKey"`
+}
+
+// OwnedEntry is an OwnedRecord together with the key of the challenge owning it.
+type OwnedEntry struct {
+	Key string
+	OwnedRecord
+}
+
+// OwnershipStore persists the records created by the webhook in a ConfigMap, keyed by
+// challenge, so that only those records are deleted again.
+type OwnershipStore struct {
+	store configMapStore
+}
+
+func NewOwnershipStore(client kubernetes.Interface, namespace, name string) *OwnershipStore {
+	return &OwnershipStore{store: configMapStore{client: client, namespace: namespace, name: name}}
+}
+
+// OwnershipKey returns the store key of a challenge, a hash of its namespace, FQDN and key.
+// These are the same for Present and CleanUp, unlike the UID of the webhook request.
+func OwnershipKey(namespace, fqdn, key string) string {
+	sum := sha256.Sum256([]byte(namespace + "/" + fqdn + "/" + key))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Get returns the records owned by the challenge with the given key.
+func (s *OwnershipStore) Get(ctx context.Context, key string) ([]OwnedRecord, error) {
+	data, err := s.store.data(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeOwnedRecords(data, key)
+}
+
+// List returns the records owned by all challenges.
+func (s *OwnershipStore) List(ctx context.Context) ([]OwnedEntry, error) {
+	data, err := s.store.data(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var entries []OwnedEntry
+	for _, key := range keys {
+		records, err := decodeOwnedRecords(data, key)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			entries = append(entries, OwnedEntry{Key: key, OwnedRecord: record})
+		}
+	}
+
+	return entries, nil
+}
+
+// Add records that the challenge with the given key owns record.
+func (s *OwnershipStore) Add(ctx context.Context, key string, record OwnedRecord) error {
+	return s.update(ctx, key, func(records []OwnedRecord) []OwnedRecord {
+		return append(records, record)
+	})
+}
+
+// Remove forgets the record with recordId owned by the challenge with the given key.
+func (s *OwnershipStore) Remove(ctx context.Context, key, recordId string) error {
+	return s.update(ctx, key, func(records []OwnedRecord) []OwnedRecord {
+		kept := records[:0]
+		for _, record := range records {
+			if record.RecordId != recordId {
+				kept = append(kept, record)
+			}
+		}
+		return kept
+	})
+}
+
+// update applies fn to the records of key and writes the result back.
+func (s *OwnershipStore) update(ctx context.Context, key string, fn func([]OwnedRecord) []OwnedRecord) error {
+	return s.store.update(ctx, func(data map[string]string) error {
+		records, err := decodeOwnedRecords(data, key)
+		if err != nil {
+			return err
+		}
+
+		records = fn(records)
+		if len(records) == 0 {
+			delete(data, key)
+			return nil
+		}
+
+		encoded, err := json.Marshal(records)
+		if err != nil {
+			return err
+		}
+		data[key] = string(encoded)
+		return nil
+	})
+}
+
+func decodeOwnedRecords(data map[string]string, key string) ([]OwnedRecord, error) {
+	encoded, ok := data[key]
+	if !ok {
+		return nil, nil
+	}
+
+	var records []OwnedRecord
+	if err := json.Unmarshal([]byte(encoded), &records); err != nil {
+		return nil, fmt.Errorf("unable to decode owned records of `%s`; %v", key, err)
+	}
+
+	return records, nil
+}
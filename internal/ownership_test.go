@@ -0,0 +1,80 @@
+package internal
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestOwnershipStore(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+	store := NewOwnershipStore(client, "cert-manager", "ownership")
+
+	records, err := store.Get(ctx, "uid-1")
+	if err != nil || len(records) != 0 {
+		t.Fatalf("Expected no records before the ConfigMap exists, but got %v, %v", records, err)
+	}
+
+	first := OwnedRecord{ZoneId: "zone1", RecordId: "record1", Name: "_acme-challenge", Value: "key1"}
+	second := OwnedRecord{ZoneId: "zone1", RecordId: "record2", Name: "_acme-challenge", Value: "key1"}
+	other := OwnedRecord{ZoneId: "zone2", RecordId: "record3", Name: "_acme-challenge.www", Value: "key2"}
+	for key, record := range map[string]OwnedRecord{"uid-1": first, "uid-2": other} {
+		if err := store.Add(ctx, key, record); err != nil {
+			t.Fatalf("Expected no error adding %s, but got: %v", key, err)
+		}
+	}
+	if err := store.Add(ctx, "uid-1", second); err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+
+	records, err = store.Get(ctx, "uid-1")
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	if len(records) != 2 || records[0].RecordId != "record1" || records[1].RecordId != "record2" {
+		t.Fatalf("Expected records record1 and record2, but got %v", records)
+	}
+
+	if err := store.Remove(ctx, "uid-1", "record1"); err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	records, _ = store.Get(ctx, "uid-1")
+	if len(records) != 1 || records[0].RecordId != "record2" {
+		t.Fatalf("Expected only record2 to remain, but got %v", records)
+	}
+
+	if err := store.Remove(ctx, "uid-1", "record2"); err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	cm, err := client.CoreV1().ConfigMaps("cert-manager").Get(ctx, "ownership", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Expected ConfigMap to exist, but got: %v", err)
+	}
+	if _, ok := cm.Data["uid-1"]; ok {
+		t.Errorf("Expected key uid-1 to be removed once empty, but got %v", cm.Data)
+	}
+	if _, ok := cm.Data["uid-2"]; !ok {
+		t.Errorf("Expected key uid-2 to be kept, but got %v", cm.Data)
+	}
+
+	entries, err := store.List(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Key != "uid-2" || entries[0].RecordId != "record3" {
+		t.Errorf("Expected only record3 of uid-2 to be listed, but got %v", entries)
+	}
+}
+
+func TestOwnershipKey(t *testing.T) {
+	key := OwnershipKey("ns", "_acme-challenge.example.com.", "key")
+	if key == "" || key != OwnershipKey("ns", "_acme-challenge.example.com.", "key") {
+		t.Errorf("Expected a stable key, but got '%s'", key)
+	}
+	if key == OwnershipKey("ns", "_acme-challenge.example.com.", "other-key") {
+		t.Errorf("Expected different keys for different challenges")
+	}
+}
@@ -0,0 +1,133 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	initialDeletionBackoff = 30 * time.Second
+	maxDeletionBackoff     = time.Hour
+)
+
+// PendingDeletion is a record whose deletion failed and is retried in the background.
+type PendingDeletion struct {
+	OwnedRecord
+	// Key of the challenge owning the record, empty when it was not tracked.
+	Key         string    `json:"key,omitempty"`
+	Enqueued    time.Time `json:"enqueued"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"nextAttempt"`
+	LastError   string    `json:"lastError,omitempty"`
+}
+
+// DeletionQueue persists pending deletions in a ConfigMap, so that they survive restarts
+// of the webhook.
+type DeletionQueue struct {
+	store configMapStore
+}
+
+func NewDeletionQueue(client kubernetes.Interface, namespace, name string) *DeletionQueue {
+	return &DeletionQueue{store: configMapStore{client: client, namespace: namespace, name: name}}
+}
+
+// DeletionBackoff returns the delay before the next attempt after the given number of
+// failed attempts: 30 seconds, doubled per attempt and capped at one hour.
+func DeletionBackoff(attempts int) time.Duration {
+	backoff := initialDeletionBackoff
+	for i := 1; i < attempts && backoff < maxDeletionBackoff; i++ {
+		backoff *= 2
+	}
+
+	return min(backoff, maxDeletionBackoff)
+}
+
+// Enqueue adds a failed deletion of record to the queue, to be retried after the backoff
+// of its first failed attempt.
+func (q *DeletionQueue) Enqueue(ctx context.Context, key string, record OwnedRecord, cause error, now time.Time) error {
+	pending := PendingDeletion{
+		OwnedRecord: record,
+		Key:         key,
+		Enqueued:    now,
+		Attempts:    1,
+		NextAttempt: now.Add(DeletionBackoff(1)),
+		LastError:   cause.Error(),
+	}
+
+	return q.store.update(ctx, func(data map[string]string) error {
+		if _, ok := data[record.RecordId]; ok {
+			// Already queued, keep its original enqueue time and backoff
+			return nil
+		}
+
+		encoded, err := json.Marshal(pending)
+		if err != nil {
+			return err
+		}
+		data[record.RecordId] = string(encoded)
+		return nil
+	})
+}
+
+// Due returns the pending deletions whose next attempt is at or before now, oldest first.
+func (q *DeletionQueue) Due(ctx context.Context, now time.Time) ([]PendingDeletion, error) {
+	data, err := q.store.data(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var due []PendingDeletion
+	for id, encoded := range data {
+		var pending PendingDeletion
+		if err := json.Unmarshal([]byte(encoded), &pending); err != nil {
+			return nil, fmt.Errorf("unable to decode pending deletion of `%s`; %v", id, err)
+		}
+		if !pending.NextAttempt.After(now) {
+			due = append(due, pending)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].Enqueued.Before(due[j].Enqueued)
+	})
+
+	return due, nil
+}
+
+// Done removes the pending deletion of recordId, after it succeeded or expired.
+func (q *DeletionQueue) Done(ctx context.Context, recordId string) error {
+	return q.store.update(ctx, func(data map[string]string) error {
+		delete(data, recordId)
+		return nil
+	})
+}
+
+// Retry records another failed attempt of the pending deletion of recordId and schedules
+// the next one.
+func (q *DeletionQueue) Retry(ctx context.Context, recordId string, cause error, now time.Time) error {
+	return q.store.update(ctx, func(data map[string]string) error {
+		encoded, ok := data[recordId]
+		if !ok {
+			return nil
+		}
+
+		var pending PendingDeletion
+		if err := json.Unmarshal([]byte(encoded), &pending); err != nil {
+			return fmt.Errorf("unable to decode pending deletion of `%s`; %v", recordId, err)
+		}
+		pending.Attempts++
+		pending.NextAttempt = now.Add(DeletionBackoff(pending.Attempts))
+		pending.LastError = cause.Error()
+
+		updated, err := json.Marshal(pending)
+		if err != nil {
+			return err
+		}
+		data[recordId] = string(updated)
+		return nil
+	})
+}
@@ -0,0 +1,79 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDeletionBackoff(t *testing.T) {
+	testCases := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{attempts: 0, expected: 30 * time.Second},
+		{attempts: 1, expected: 30 * time.Second},
+		{attempts: 2, expected: time.Minute},
+		{attempts: 4, expected: 4 * time.Minute},
+		{attempts: 8, expected: time.Hour},
+		{attempts: 100, expected: time.Hour},
+	}
+
+	for _, tc := range testCases {
+		if got := DeletionBackoff(tc.attempts); got != tc.expected {
+			t.Errorf("Expected backoff %s after %d attempts, but got %s", tc.expected, tc.attempts, got)
+		}
+	}
+}
+
+func TestDeletionQueue(t *testing.T) {
+	ctx := context.Background()
+	queue := NewDeletionQueue(fake.NewSimpleClientset(), "cert-manager", "pending-deletions")
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	cause := errors.New("service unavailable")
+
+	if err := queue.Enqueue(ctx, "uid-1", OwnedRecord{RecordId: "r1"}, cause, now); err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	if err := queue.Enqueue(ctx, "", OwnedRecord{RecordId: "r2"}, cause, now.Add(time.Minute)); err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	// Enqueueing again keeps the original schedule
+	if err := queue.Enqueue(ctx, "uid-1", OwnedRecord{RecordId: "r1"}, cause, now.Add(time.Hour)); err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+
+	due, err := queue.Due(ctx, now)
+	if err != nil || len(due) != 0 {
+		t.Fatalf("Expected nothing to be due before the first backoff, but got %v, %v", due, err)
+	}
+
+	due, err = queue.Due(ctx, now.Add(2*time.Minute))
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	if len(due) != 2 || due[0].RecordId != "r1" || due[0].Key != "uid-1" || due[1].RecordId != "r2" {
+		t.Fatalf("Expected r1 and r2 to be due, but got %v", due)
+	}
+
+	if err := queue.Retry(ctx, "r1", errors.New("still unavailable"), now.Add(2*time.Minute)); err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	if err := queue.Done(ctx, "r2"); err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+
+	due, err = queue.Due(ctx, now.Add(3*time.Minute))
+	if err != nil || len(due) != 1 {
+		t.Fatalf("Expected only the retried r1 to be due, but got %v, %v", due, err)
+	}
+	if due[0].Attempts != 2 || due[0].LastError != "still unavailable" {
+		t.Errorf("Expected 2 attempts with the last error, but got %+v", due[0])
+	}
+	if !due[0].Enqueued.Equal(now) {
+		t.Errorf("Expected the enqueue time to be kept, but got %s", due[0].Enqueued)
+	}
+}
@@ -0,0 +1,104 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/trijpstra-fourlights/cert-manager-webhook-hetzner"
+
+// Protocols of the OTLP trace exporter.
+const (
+	TracingProtocolGRPC = "grpc"
+	TracingProtocolHTTP = "http/protobuf"
+)
+
+// TracingOptions configure the export of traces. They follow the standard OpenTelemetry
+// environment variables; the endpoint, headers and sampler (OTEL_TRACES_SAMPLER and
+// OTEL_TRACES_SAMPLER_ARG) are read by the SDK itself.
+type TracingOptions struct {
+	// Enabled is set when an OTLP endpoint is configured.
+	Enabled  bool
+	Protocol string
+}
+
+// TracingOptionsFromEnv reads the tracing options from the environment.
+func TracingOptionsFromEnv() (TracingOptions, error) {
+	opts := TracingOptions{Protocol: TracingProtocolGRPC}
+	opts.Enabled = os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != ""
+
+	protocol := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL")
+	if protocol == "" {
+		protocol = os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+	}
+	switch protocol {
+	case "":
+	case TracingProtocolGRPC, TracingProtocolHTTP:
+		opts.Protocol = protocol
+	default:
+		return opts, fmt.Errorf("unsupported OTLP protocol `%s`, expected `%s` or `%s`", protocol, TracingProtocolGRPC, TracingProtocolHTTP)
+	}
+
+	return opts, nil
+}
+
+// StartTracing installs the global tracer provider exporting spans as configured by opts,
+// and returns the function flushing and stopping it. Without an endpoint spans are not
+// recorded.
+func StartTracing(ctx context.Context, opts TracingOptions) (shutdown func(context.Context) error, err error) {
+	if !opts.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var exporter *otlptrace.Exporter
+	if opts.Protocol == TracingProtocolHTTP {
+		exporter, err = otlptracehttp.New(ctx)
+	} else {
+		exporter, err = otlptracegrpc.New(ctx)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to create OTLP trace exporter; %v", err)
+	}
+
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the service name
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName("cert-manager-webhook-hetzner")),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK())
+	if err != nil {
+		return nil, fmt.Errorf("unable to create trace resource; %v", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return provider.Shutdown, nil
+}
+
+// StartSpan starts a span called name as a child of the span in ctx.
+func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// EndSpan ends span, marking it failed when err is set.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
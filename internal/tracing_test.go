@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracingOptionsFromEnv(t *testing.T) {
+	testCases := []struct {
+		name           string
+		env            map[string]string
+		expectEnabled  bool
+		expectProtocol string
+		expectErr      bool
+	}{
+		{"no endpoint", map[string]string{}, false, TracingProtocolGRPC, false},
+		{"endpoint", map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4317"}, true, TracingProtocolGRPC, false},
+		{"traces endpoint", map[string]string{"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "http://collector:4318/v1/traces"}, true, TracingProtocolGRPC, false},
+		{"http protocol", map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318", "OTEL_EXPORTER_OTLP_PROTOCOL": "http/protobuf"}, true, TracingProtocolHTTP, false},
+		{"traces protocol takes precedence", map[string]string{"OTEL_EXPORTER_OTLP_PROTOCOL": "http/protobuf", "OTEL_EXPORTER_OTLP_TRACES_PROTOCOL": "grpc"}, false, TracingProtocolGRPC, false},
+		{"unsupported protocol", map[string]string{"OTEL_EXPORTER_OTLP_PROTOCOL": "http/json"}, false, "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, name := range []string{"OTEL_EXPORTER_OTLP_ENDPOINT", "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "OTEL_EXPORTER_OTLP_PROTOCOL", "OTEL_EXPORTER_OTLP_TRACES_PROTOCOL"} {
+				t.Setenv(name, tc.env[name])
+			}
+
+			opts, err := TracingOptionsFromEnv()
+			if tc.expectErr {
+				if err == nil {
+					t.Errorf("Expected an error, but got %+v", opts)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if opts.Enabled != tc.expectEnabled {
+				t.Errorf("Expected enabled %t, but got %t", tc.expectEnabled, opts.Enabled)
+			}
+			if opts.Protocol != tc.expectProtocol {
+				t.Errorf("Expected protocol %q, but got %q", tc.expectProtocol, opts.Protocol)
+			}
+		})
+	}
+}
+
+func TestSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(previous)
+
+	ctx, parent := StartSpan(context.Background(), "Present")
+	_, child := StartSpan(ctx, "zone search")
+	EndSpan(child, errors.New("zone not found"))
+	EndSpan(parent, nil)
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, but got %d", len(spans))
+	}
+	if spans[0].Parent().SpanID() != spans[1].SpanContext().SpanID() {
+		t.Errorf("Expected `%s` to be a child of `%s`", spans[0].Name(), spans[1].Name())
+	}
+	if spans[0].Status().Code != codes.Error || spans[0].Status().Description != "zone not found" {
+		t.Errorf("Expected error status, but got %+v", spans[0].Status())
+	}
+	if spans[1].Status().Code != codes.Unset {
+		t.Errorf("Expected unset status, but got %+v", spans[1].Status())
+	}
+}
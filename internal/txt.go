@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxTxtChunk is the maximum length of a single TXT character string.
+const maxTxtChunk = 255
+
+// EncodeTxt returns value in zone-file presentation form: quoted character strings of at most
+// 255 bytes each, separated by spaces, with quotes, backslashes and non-printable bytes
+// escaped.
+func EncodeTxt(value string) string {
+	if value == "" {
+		return `""`
+	}
+
+	var b strings.Builder
+	for start := 0; start < len(value); start += maxTxtChunk {
+		end := min(start+maxTxtChunk, len(value))
+		if start > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteByte('"')
+		for i := start; i < end; i++ {
+			c := value[i]
+			switch {
+			case c == '"' || c == '\\':
+				b.WriteByte('\\')
+				b.WriteByte(c)
+			case c < 0x20 || c > 0x7e:
+				fmt.Fprintf(&b, "\\%03d", c)
+			default:
+				b.WriteByte(c)
+			}
+		}
+		b.WriteByte('"')
+	}
+
+	return b.String()
+}
+
+// DecodeTxt returns the value of a TXT record in presentation form, concatenating its
+// quoted or unquoted character strings and resolving escapes. A value that is not quoted
+// at all is returned as is.
+func DecodeTxt(presentation string) string {
+	if !strings.ContainsAny(presentation, `"\`) {
+		return presentation
+	}
+
+	var b strings.Builder
+	s := presentation
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			return b.String()
+		}
+
+		quoted := s[0] == '"'
+		if quoted {
+			s = s[1:]
+		}
+		for s != "" {
+			c := s[0]
+			if quoted && c == '"' {
+				s = s[1:]
+				break
+			}
+			if !quoted && (c == ' ' || c == '\t') {
+				break
+			}
+			if c == '\\' && len(s) > 1 {
+				if len(s) > 3 && isDigit(s[1]) && isDigit(s[2]) && isDigit(s[3]) {
+					b.WriteByte((s[1]-'0')*100 + (s[2]-'0')*10 + (s[3] - '0'))
+					s = s[4:]
+					continue
+				}
+				b.WriteByte(s[1])
+				s = s[2:]
+				continue
+			}
+			b.WriteByte(c)
+			s = s[1:]
+		}
+	}
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
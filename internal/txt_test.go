@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEncodeTxt(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected string
+	}{
+		{"", `""`},
+		{"LHDhK3oGRvkiefQnx7OOczTY5Tic_xZ6HcMOc_gmtoM", `"LHDhK3oGRvkiefQnx7OOczTY5Tic_xZ6HcMOc_gmtoM"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{`back\slash`, `"back\\slash"`},
+		{"tab\there", `"tab\009here"`},
+		{"münchen", `"m\195\188nchen"`},
+		{strings.Repeat("a", 255), `"` + strings.Repeat("a", 255) + `"`},
+		{strings.Repeat("a", 256), `"` + strings.Repeat("a", 255) + `" "a"`},
+	}
+
+	for _, tc := range testCases {
+		if encoded := EncodeTxt(tc.value); encoded != tc.expected {
+			t.Errorf("Expected %q to be encoded as %s, but got %s", tc.value, tc.expected, encoded)
+		}
+	}
+}
+
+func TestDecodeTxt(t *testing.T) {
+	testCases := []struct {
+		presentation string
+		expected     string
+	}{
+		{"unquoted", "unquoted"},
+		{`""`, ""},
+		{`"quoted"`, "quoted"},
+		{`"first" "second"`, "firstsecond"},
+		{`"with space"  unquoted`, "with spaceunquoted"},
+		{`"say \"hi\""`, `say "hi"`},
+		{`"m\195\188nchen"`, "münchen"},
+		{`"unterminated`, "unterminated"},
+	}
+
+	for _, tc := range testCases {
+		if decoded := DecodeTxt(tc.presentation); decoded != tc.expected {
+			t.Errorf("Expected %s to be decoded as %q, but got %q", tc.presentation, tc.expected, decoded)
+		}
+	}
+}
+
+func TestTxtRoundTrip(t *testing.T) {
+	values := []string{
+		"",
+		"LHDhK3oGRvkiefQnx7OOczTY5Tic_xZ6HcMOc_gmtoM",
+		`quotes " and backslashes \ and \123`,
+		"control\x00\x7f\xff bytes",
+		strings.Repeat("0123456789", 100),
+		strings.Repeat(`"`, 300),
+	}
+
+	for _, value := range values {
+		encoded := EncodeTxt(value)
+		if decoded := DecodeTxt(encoded); decoded != value {
+			t.Errorf("Expected %q to survive the round trip, but got %q via %s", value, decoded, encoded)
+		}
+		for _, chunk := range strings.Split(encoded, `" "`) {
+			if n := len(DecodeTxt(`"` + strings.Trim(chunk, `"`) + `"`)); n > maxTxtChunk {
+				t.Errorf("Expected chunks of at most %d bytes, but got %d in %s", maxTxtChunk, n, encoded)
+			}
+		}
+	}
+}
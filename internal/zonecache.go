@@ -0,0 +1,67 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// ZoneCache remembers the ids of zones found in the API for a limited time, so that the
+// zone search does not repeat the same lookups for every challenge.
+type ZoneCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]zoneCacheEntry
+}
+
+type zoneCacheEntry struct {
+	id      string
+	expires time.Time
+}
+
+func NewZoneCache(ttl time.Duration) *ZoneCache {
+	return &ZoneCache{ttl: ttl, entries: map[string]zoneCacheEntry{}}
+}
+
+// ZoneCacheKey returns the key of zoneName as seen with the credentials of config. The API
+// key is hashed, so that it is not kept in memory twice.
+func ZoneCacheKey(config Config, zoneName string) string {
+	sum := sha256.Sum256([]byte(config.ApiKey))
+	return config.ApiUrl + "|" + config.ApiFlavor + "|" + hex.EncodeToString(sum[:8]) + "|" + zoneName
+}
+
+// Get returns the cached zone id of key at now.
+func (c *ZoneCache) Get(key string, now time.Time) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if ok && now.After(entry.expires) {
+		delete(c.entries, key)
+		ok = false
+	}
+	if ok {
+		zoneCacheLookups.WithLabelValues("hit").Inc()
+	} else {
+		zoneCacheLookups.WithLabelValues("miss").Inc()
+	}
+
+	return entry.id, ok
+}
+
+// Put caches the zone id of key from now on.
+func (c *ZoneCache) Put(key, id string, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[key] = zoneCacheEntry{id: id, expires: now.Add(c.ttl)}
+}
+
+// Forget removes the zone id of key, when the zone turned out to be gone.
+func (c *ZoneCache) Forget(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, key)
+}
@@ -0,0 +1,37 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestZoneCache(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	cache := NewZoneCache(time.Minute)
+	config := Config{ApiUrl: "https://api.hetzner.cloud/v1", ApiKey: "token"}
+	key := ZoneCacheKey(config, "example.com")
+
+	if _, ok := cache.Get(key, now); ok {
+		t.Error("Expected a miss for an empty cache")
+	}
+
+	cache.Put(key, "42", now)
+	if id, ok := cache.Get(key, now.Add(30*time.Second)); !ok || id != "42" {
+		t.Errorf("Expected a hit with id 42, but got %q, %v", id, ok)
+	}
+	if _, ok := cache.Get(key, now.Add(2*time.Minute)); ok {
+		t.Error("Expected a miss after the ttl")
+	}
+
+	cache.Put(key, "42", now)
+	cache.Forget(key)
+	if _, ok := cache.Get(key, now); ok {
+		t.Error("Expected a miss for a forgotten zone")
+	}
+
+	other := config
+	other.ApiKey = "other-token"
+	if ZoneCacheKey(other, "example.com") == key {
+		t.Error("Expected zones of different accounts to have different keys")
+	}
+}
@@ -0,0 +1,74 @@
+package internal
+
+import (
+	"strings"
+)
+
+// MostSpecificZone returns the index of the entry in zones that most specifically
+// covers fqdn, or -1 if none of them does. An entry covers fqdn when fqdn equals the
+// entry or is a subdomain of it; the entry with the most labels wins.
+// Example: fqdn = _acme-challenge.www.example.com., zones = [example.com, www.example.com] -> 1
+func MostSpecificZone(fqdn string, zones []string) int {
+	best, bestLabels := -1, 0
+	for i, zone := range zones {
+		if !IsInZone(fqdn, zone) {
+			continue
+		}
+
+		labels := strings.Count(normalizeDomainOrLower(zone), ".") + 1
+		if labels > bestLabels {
+			best, bestLabels = i, labels
+		}
+	}
+
+	return best
+}
+
+// IsInZone reports whether fqdn equals zone or is a subdomain of it.
+// Example: fqdn = _acme-challenge.example.com., zone = example.com -> true
+// Example: fqdn = _acme-challenge.example.org., zone = example.com -> false
+func IsInZone(fqdn, zone string) bool {
+	name := normalizeDomainOrLower(fqdn)
+	zone = normalizeDomainOrLower(zone)
+	if zone == "" {
+		return false
+	}
+
+	return name == zone || strings.HasSuffix(name, "."+zone)
+}
+
+// MatchDelegation returns the target of the delegation pattern that most specifically
+// matches domain. A pattern is either a domain name matching itself only, or a wildcard
+// such as *.example.com matching every subdomain of example.com and example.com itself,
+// as cert-manager challenges a wildcard certificate at the apex. Exact patterns take
+// precedence over wildcards.
+// Example: domain = www.customer.com, delegations = {*.customer.com: acme.validation.net} -> acme.validation.net
+// Example: domain = customer.com, delegations = {*.customer.com: acme.validation.net} -> acme.validation.net
+func MatchDelegation(domain string, delegations map[string]string) (string, bool) {
+	name := normalizeDomainOrLower(strings.TrimPrefix(domain, "*."))
+
+	target, bestLabels := "", -1
+	for pattern, patternTarget := range delegations {
+		wildcard := strings.HasPrefix(pattern, "*.")
+		base := normalizeDomainOrLower(strings.TrimPrefix(pattern, "*."))
+		if base == "" {
+			continue
+		}
+
+		// Rank exact patterns one label above wildcards of the same base
+		labels := 2 * (strings.Count(base, ".") + 1)
+		switch {
+		case !wildcard && name == base:
+			labels++
+		case wildcard && (name == base || strings.HasSuffix(name, "."+base)):
+		default:
+			continue
+		}
+
+		if labels > bestLabels {
+			target, bestLabels = patternTarget, labels
+		}
+	}
+
+	return target, bestLabels >= 0
+}
@@ -0,0 +1,154 @@
+package internal
+
+import (
+	"testing"
+)
+
+func TestMostSpecificZone(t *testing.T) {
+	testCases := []struct {
+		name     string
+		fqdn     string
+		zones    []string
+		expected int
+	}{
+		{
+			name:     "Single matching zone",
+			fqdn:     "_acme-challenge.example.com.",
+			zones:    []string{"example.com"},
+			expected: 0,
+		},
+		{
+			name:     "Most specific zone wins",
+			fqdn:     "_acme-challenge.www.example.com.",
+			zones:    []string{"example.com", "www.example.com", "com"},
+			expected: 1,
+		},
+		{
+			name:     "Zone with trailing dot and different case",
+			fqdn:     "_acme-challenge.WWW.Example.com",
+			zones:    []string{"other.org", "example.COM."},
+			expected: 1,
+		},
+		{
+			name:     "Zone equal to fqdn",
+			fqdn:     "example.com.",
+			zones:    []string{"example.com"},
+			expected: 0,
+		},
+		{
+			name:     "Label boundary is respected",
+			fqdn:     "_acme-challenge.myexample.com.",
+			zones:    []string{"example.com"},
+			expected: -1,
+		},
+		{
+			name:     "Empty zones are ignored",
+			fqdn:     "_acme-challenge.example.com.",
+			zones:    []string{"", "."},
+			expected: -1,
+		},
+		{
+			name:     "No zones",
+			fqdn:     "_acme-challenge.example.com.",
+			zones:    nil,
+			expected: -1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := MostSpecificZone(tc.fqdn, tc.zones); got != tc.expected {
+				t.Errorf("Expected index %d, but got %d", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestIsInZone(t *testing.T) {
+	testCases := []struct {
+		fqdn     string
+		zone     string
+		expected bool
+	}{
+		{fqdn: "_acme-challenge.example.com.", zone: "example.com", expected: true},
+		{fqdn: "_acme-challenge.www.example.com", zone: "example.com.", expected: true},
+		{fqdn: "example.com.", zone: "Example.Com", expected: true},
+		{fqdn: "_acme-challenge.example.org.", zone: "example.com", expected: false},
+		{fqdn: "_acme-challenge.notexample.com.", zone: "example.com", expected: false},
+		{fqdn: "_acme-challenge.example.com.", zone: "", expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.fqdn+"/"+tc.zone, func(t *testing.T) {
+			if got := IsInZone(tc.fqdn, tc.zone); got != tc.expected {
+				t.Errorf("Expected %v, but got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestMatchDelegation(t *testing.T) {
+	delegations := map[string]string{
+		"*.customer.com":      "acme.validation.net",
+		"customer.com":        "apex.validation.net",
+		"*.shop.customer.com": "shop.validation.net",
+		"München.de":          "muenchen.validation.net",
+	}
+
+	testCases := []struct {
+		domain        string
+		expected      string
+		expectedMatch bool
+	}{
+		{domain: "www.customer.com", expected: "acme.validation.net", expectedMatch: true},
+		{domain: "a.b.customer.com.", expected: "acme.validation.net", expectedMatch: true},
+		{domain: "customer.com", expected: "apex.validation.net", expectedMatch: true},
+		{domain: "*.customer.com", expected: "apex.validation.net", expectedMatch: true},
+		{domain: "www.shop.customer.com", expected: "shop.validation.net", expectedMatch: true},
+		{domain: "shop.customer.com", expected: "shop.validation.net", expectedMatch: true},
+		{domain: "xn--mnchen-3ya.de", expected: "muenchen.validation.net", expectedMatch: true},
+		{domain: "othercustomer.com", expectedMatch: false},
+		{domain: "example.org", expectedMatch: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.domain, func(t *testing.T) {
+			target, ok := MatchDelegation(tc.domain, delegations)
+			if ok != tc.expectedMatch {
+				t.Fatalf("Expected match %v, but got %v", tc.expectedMatch, ok)
+			}
+			if target != tc.expected {
+				t.Errorf("Expected target '%s', but got '%s'", tc.expected, target)
+			}
+		})
+	}
+}
+
+func TestMatchDelegationWildcardOnly(t *testing.T) {
+	delegations := map[string]string{
+		"*.customer.com": "acme.validation.net",
+	}
+
+	testCases := []struct {
+		domain        string
+		expected      string
+		expectedMatch bool
+	}{
+		// cert-manager passes the DNS name of a wildcard certificate without the wildcard
+		{domain: "customer.com", expected: "acme.validation.net", expectedMatch: true},
+		{domain: "www.customer.com", expected: "acme.validation.net", expectedMatch: true},
+		{domain: "othercustomer.com", expectedMatch: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.domain, func(t *testing.T) {
+			target, ok := MatchDelegation(tc.domain, delegations)
+			if ok != tc.expectedMatch {
+				t.Fatalf("Expected match %v, but got %v", tc.expectedMatch, ok)
+			}
+			if target != tc.expected {
+				t.Errorf("Expected target '%s', but got '%s'", tc.expected, target)
+			}
+		})
+	}
+}
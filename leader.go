@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/klog/v2"
+)
+
+const defaultLeaderElectionLease = "cert-manager-webhook-hetzner-leader"
+
+// coordinationOptions configures how webhook replicas coordinate through Kubernetes Leases.
+type coordinationOptions struct {
+	// LeaderElection restricts the background jobs to the replica holding LeaderLease.
+	LeaderElection bool
+	LeaderLease    string
+	// RecordLeases serializes writes to a record across replicas with a Lease per record,
+	// held for at most RecordLeaseDuration.
+	RecordLeases        bool
+	RecordLeaseDuration time.Duration
+}
+
+// coordinationOptionsFromEnv reads the coordination options from LEADER_ELECTION,
+// LEADER_ELECTION_LEASE, RECORD_LEASES and RECORD_LEASE_DURATION.
+func coordinationOptionsFromEnv() (coordinationOptions, error) {
+	opts := coordinationOptions{
+		LeaderElection:      true,
+		LeaderLease:         defaultLeaderElectionLease,
+		RecordLeaseDuration: 30 * time.Second,
+	}
+
+	var err error
+	if v := os.Getenv("LEADER_ELECTION"); v != "" {
+		if opts.LeaderElection, err = strconv.ParseBool(v); err != nil {
+			return opts, fmt.Errorf("invalid LEADER_ELECTION `%s`; %v", v, err)
+		}
+	}
+	if v := os.Getenv("LEADER_ELECTION_LEASE"); v != "" {
+		opts.LeaderLease = v
+	}
+	if v := os.Getenv("RECORD_LEASES"); v != "" {
+		if opts.RecordLeases, err = strconv.ParseBool(v); err != nil {
+			return opts, fmt.Errorf("invalid RECORD_LEASES `%s`; %v", v, err)
+		}
+	}
+	if v := os.Getenv("RECORD_LEASE_DURATION"); v != "" {
+		if opts.RecordLeaseDuration, err = time.ParseDuration(v); err != nil {
+			return opts, fmt.Errorf("invalid RECORD_LEASE_DURATION `%s`; %v", v, err)
+		}
+	}
+	if opts.RecordLeaseDuration < time.Second {
+		return opts, fmt.Errorf("RECORD_LEASE_DURATION must be at least 1s, got `%s`", opts.RecordLeaseDuration)
+	}
+
+	return opts, nil
+}
+
+// podIdentity returns the name identifying this replica as holder of Leases.
+func podIdentity() string {
+	if name := os.Getenv("POD_NAME"); name != "" {
+		return name
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		return hostname
+	}
+	return "cert-manager-webhook-hetzner"
+}
+
+// runAsLeader runs jobs whenever this replica is elected leader through the Lease of opts,
+// stopping them as soon as leadership is lost, until stopCh is closed.
+func runAsLeader(client kubernetes.Interface, opts coordinationOptions, stopCh <-chan struct{}, jobs func(stopCh <-chan struct{})) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+
+	identity := podIdentity()
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta:  metav1.ObjectMeta{Name: opts.LeaderLease, Namespace: webhookNamespace()},
+		Client:     client.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+	}
+
+	for ctx.Err() == nil {
+		leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			LeaseDuration:   15 * time.Second,
+			RenewDeadline:   10 * time.Second,
+			RetryPeriod:     2 * time.Second,
+			ReleaseOnCancel: true,
+			Name:            opts.LeaderLease,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					klog.InfoS("Elected leader, starting background jobs", "identity", identity)
+					jobs(ctx.Done())
+				},
+				OnStoppedLeading: func() {
+					klog.InfoS("No longer leader, background jobs stopped", "identity", identity)
+				},
+				OnNewLeader: func(leader string) {
+					if leader != identity {
+						klog.V(4).InfoS("Background jobs run on another leader", "leader", leader)
+					}
+				},
+			},
+		})
+	}
+}
@@ -3,46 +3,207 @@ package main
 import (
 	"bytes"
 	"context"
-	"errors"
 	"io"
 	"net/http"
 	"strings"
+	"time"
 
 	"encoding/json"
 	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"syscall"
 
 	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/client-go/rest"
 
 	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
-	"github.com/cert-manager/cert-manager/pkg/acme/webhook/cmd"
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/cmd/server"
+	logf "github.com/cert-manager/cert-manager/pkg/logs"
+	"github.com/spf13/cobra"
 	"github.com/trijpstra-fourlights/cert-manager-webhook-hetzner/internal"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"golang.org/x/sync/singleflight"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/component-base/logs"
 	"k8s.io/klog/v2"
+	ctrl "sigs.k8s.io/controller-runtime"
 )
 
 var GroupName = os.Getenv("GROUP_NAME")
 
+const (
+	zoneMismatchFail     = "fail"
+	zoneMismatchDiscover = "discover"
+
+	defaultOwnershipConfigMap     = "cert-manager-webhook-hetzner-ownership"
+	defaultDeletionQueueConfigMap = "cert-manager-webhook-hetzner-pending-deletions"
+
+	// maxThrottleRetries and maxThrottleWait bound the retries of rate limited API requests.
+	maxThrottleRetries = 3
+	maxThrottleWait    = 30 * time.Second
+
+	zoneCacheTTL = 5 * time.Minute
+	// healthCheckTimeout bounds each request of the Hetzner API readiness check.
+	healthCheckTimeout = 10 * time.Second
+)
+
+var zoneCache = internal.NewZoneCache(zoneCacheTTL)
+
 func main() {
-	if GroupName == "" {
-		panic("GROUP_NAME must be specified")
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	logs.InitLogs()
+	defer logs.FlushLogs()
+	// API tokens read by the webhook never make it into the logs
+	klog.SetLogFilter(internal.LogRedactor{})
+	logger := internal.NewLogger()
+	ctrl.SetLogger(logf.Log)
+	ctx = logf.NewContext(ctx, logf.Log, "acme-dns-webhook")
+
+	tracing, err := internal.TracingOptionsFromEnv()
+	if err != nil {
+		logger.Error(err, "Invalid tracing configuration")
+		logs.FlushLogs()
+		os.Exit(1)
+	}
+	stopTracing, err := internal.StartTracing(ctx, tracing)
+	if err != nil {
+		logger.Error(err, "Unable to start tracing")
+		logs.FlushLogs()
+		os.Exit(1)
 	}
+	// Flushes the spans still buffered, also before exiting on errors
+	flushTraces := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := stopTracing(ctx); err != nil {
+			logger.Error(err, "Unable to flush traces")
+		}
+	}
+	defer flushTraces()
 
-	cmd.RunWebhookServer(GroupName,
-		&hetznerDNSProviderSolver{},
-	)
+	// Same default as cmd.RunWebhookServer
+	if len(os.Getenv("GOMAXPROCS")) == 0 {
+		runtime.GOMAXPROCS(runtime.NumCPU())
+	}
+
+	// Built like cmd.RunWebhookServer, which does not expose the command it runs, so that
+	// the metrics and readiness flags can be added to it
+	solver := &hetznerDNSProviderSolver{health: internal.NewAPIHealth(healthCheckTimeout)}
+	command := server.NewCommandStartWebhookServer(ctx, GroupName, solver)
+	command.Use = filepath.Base(os.Args[0])
+	// Subcommands run the solver outside the webhook server, without Kubernetes
+	command.AddCommand(cliCommands()...)
+
+	var metricsAddress, healthAddress string
+	command.Flags().StringVar(&metricsAddress, "metrics-bind-address", ":9402",
+		"Address the Prometheus metrics are served on, or 0 to disable them")
+	command.Flags().StringVar(&healthAddress, "health-probe-bind-address", ":9403",
+		"Address the readiness check of the webhook and the Hetzner API is served on at /readyz, or 0 to disable it")
+
+	runWebhookServer := command.RunE
+	command.RunE = func(c *cobra.Command, args []string) error {
+		if GroupName == "" {
+			return fmt.Errorf("GROUP_NAME must be specified")
+		}
+		if metricsAddress != "0" {
+			go serveMetrics(c.Context(), metricsAddress)
+		}
+		if healthAddress != "0" {
+			securePort, _ := c.Flags().GetInt("secure-port")
+			go serveHealth(c.Context(), healthAddress, solver.health, fmt.Sprintf("https://127.0.0.1:%d/healthz", securePort))
+		}
+		return runWebhookServer(c, args)
+	}
+
+	if err := command.ExecuteContext(ctx); err != nil {
+		logger.Error(err, "Error executing command")
+		flushTraces()
+		logs.FlushLogs()
+		os.Exit(1)
+	}
 }
 
 type hetznerDNSProviderSolver struct {
-	client *kubernetes.Clientset
+	client    *kubernetes.Clientset
+	ownership *internal.OwnershipStore
+	deletions *internal.DeletionQueue
+	events    *internal.ChallengeEvents
+	audit     *internal.AuditLog
+	// health checks the reachability of the Hetzner API endpoints in use.
+	health *internal.APIHealth
+	// clusterID identifies this cluster in the records it manages, so that clusters
+	// sharing a zone never clean up each other's records.
+	clusterID string
+	// cleanupUntracked makes CleanUp of a challenge without tracked records delete the
+	// record matching its name and key, e.g. for challenges presented before upgrading.
+	cleanupUntracked bool
+
+	// recordLocks serializes Present and CleanUp per zone and record name, inflight
+	// deduplicates identical concurrent calls.
+	recordLocks internal.KeyedMutex
+	inflight    singleflight.Group
+	// apiToken is used instead of the token in the secret referenced by the config, when
+	// running outside Kubernetes.
+	apiToken string
+
+	// recordLeases additionally serializes them across replicas, when enabled.
+	recordLeases        *internal.LeaseLocker
+	recordLeaseDuration time.Duration
 }
 
 type hetznerDNSProviderConfig struct {
 	SecretRef string `json:"secretName"`
+	SecretKey string `json:"secretKey"`
 	ZoneName  string `json:"zoneName"`
 	ApiUrl    string `json:"apiUrl"`
+	// ApiFlavor selects the API spoken at ApiUrl: "legacy" for the DNS API of
+	// dns.hetzner.com, "cloud" for the DNS API of the Hetzner Cloud. By default it is
+	// detected from the host of ApiUrl.
+	ApiFlavor string `json:"apiFlavor"`
+	// ZoneMismatchPolicy decides what happens when ZoneName does not contain the
+	// challenge FQDN: "fail" (default) rejects the challenge, "discover" ignores
+	// ZoneName and searches the zone in the API instead.
+	ZoneMismatchPolicy string `json:"zoneMismatchPolicy"`
+	// FollowCNAME resolves the CNAME chain of the challenge FQDN using Nameservers and
+	// writes the TXT record at its final target, which must lie in one of AllowedZones
+	// when those are set.
+	FollowCNAME  bool     `json:"followCNAME"`
+	Nameservers  []string `json:"nameservers"`
+	AllowedZones []string `json:"allowedZones"`
+	// Delegations maps challenged domains (e.g. "*.customer.com") to the FQDN of the TXT
+	// record in a dedicated validation zone (e.g. "acme.validation.example.net"). They
+	// take precedence over FollowCNAME.
+	Delegations map[string]string `json:"delegations"`
+	// LegacyCleanup makes CleanUp delete any record matching the challenge name and key
+	// instead of only the records this webhook recorded as created by it.
+	LegacyCleanup bool `json:"legacyCleanup"`
+	// Zones lets a single issuer serve domains from several Hetzner accounts. The entry
+	// most specifically covering the challenge FQDN overrides the fields above.
+	Zones []hetznerZoneConfig `json:"zones"`
+}
+
+// hetznerZoneConfig describes the credentials and API used for one zone. Either
+// ZoneName (the exact Hetzner zone) or Suffix (a domain suffix whose zone is searched
+// in the API) selects the entry. Empty SecretRef, SecretKey, ApiUrl and ApiFlavor are
+// inherited from the top-level configuration.
+type hetznerZoneConfig struct {
+	ZoneName  string `json:"zoneName"`
+	Suffix    string `json:"suffix"`
+	SecretRef string `json:"secretName"`
+	SecretKey string `json:"secretKey"`
+	ApiUrl    string `json:"apiUrl"`
+	ApiFlavor string `json:"apiFlavor"`
 }
 
 func (c *hetznerDNSProviderSolver) Name() string {
@@ -50,84 +211,394 @@ func (c *hetznerDNSProviderSolver) Name() string {
 }
 
 func (c *hetznerDNSProviderSolver) Present(ch *v1alpha1.ChallengeRequest) error {
-	klog.V(6).Infof("call function Present: namespace=%s, zone=%s, fqdn=%s",
-		ch.ResourceNamespace, ch.ResolvedZone, ch.ResolvedFQDN)
+	return c.dedupe("present", ch, c.present)
+}
 
-	config, err := clientConfig(c, ch)
+func (c *hetznerDNSProviderSolver) present(ch *v1alpha1.ChallengeRequest) (err error) {
+	start := time.Now()
+	var config internal.Config
+	ctx, span := internal.StartSpan(context.Background(), "Present",
+		attribute.String("namespace", ch.ResourceNamespace),
+		attribute.String("fqdn", ch.ResolvedFQDN),
+	)
+	defer func() {
+		span.SetAttributes(attribute.String("zone", config.ZoneName))
+		internal.EndSpan(span, err)
+		internal.ObserveOperation("present", config.ZoneName, start, err)
+	}()
+	logger := challengeLogger(ch).WithName("present")
+	ctx = klog.NewContext(ctx, logger)
+	logger.V(6).Info("Starting Present", "zone", ch.ResolvedZone)
+
+	events := c.challengeEvents(ch)
+	config, err = clientConfig(ctx, c, ch)
 
 	if err != nil {
-		return fmt.Errorf("unable to get secret `%s`; %v", ch.ResourceNamespace, err)
+		if internal.IsZoneNotFound(err) {
+			events.Eventf(corev1.EventTypeWarning, internal.EventZoneNotFound, "No Hetzner zone found for %s: %v", ch.ResolvedFQDN, err)
+		}
+		return fmt.Errorf("unable to get secret `%s`; %w", ch.ResourceNamespace, err)
 	}
+	logger = logger.WithValues("zone", config.ZoneName)
+	ctx = klog.NewContext(ctx, logger)
+	events.Eventf(corev1.EventTypeNormal, internal.EventZoneResolved, "Using Hetzner zone %s for %s", config.ZoneName, config.Fqdn)
 
-	addTxtRecord(config, ch)
+	unlock, err := c.lockRecord(ctx, config)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
-	klog.Infof("Presented txt record %v", ch.ResolvedFQDN)
+	record, err := c.addTxtRecord(ctx, config, ch, c.recordLabels(), events)
+	if err != nil {
+		if internal.IsZoneNotFound(err) {
+			events.Eventf(corev1.EventTypeWarning, internal.EventZoneNotFound, "%v", err)
+		}
+		return err
+	}
+
+	if !config.LegacyCleanup && c.ownership != nil {
+		owned := c.ownedRecord(config, record, ch.Key)
+		if err := c.ownership.Add(ctx, ownershipKey(ch), owned); err != nil {
+			// Without ownership the record would never be cleaned up, so undo it
+			delErr := backendFor(config).deleteTxtRecord(ctx, config, owned)
+			c.auditChange(ctx, internal.AuditDelete, "present", owned, events, delErr)
+			if delErr != nil {
+				logger.Error(delErr, "Unable to delete untracked TXT record", "record", record.Id)
+			}
+			return err
+		}
+	}
+
+	logger.Info("Presented TXT record", "record", record.Id, "name", record.Name)
+	events.Eventf(corev1.EventTypeNormal, internal.EventRecordCreated, "Created TXT record %s in zone %s", record.Name, config.ZoneName)
 
 	return nil
 }
 
 func (c *hetznerDNSProviderSolver) CleanUp(ch *v1alpha1.ChallengeRequest) error {
-	config, err := clientConfig(c, ch)
+	return c.dedupe("cleanup", ch, c.cleanUp)
+}
+
+func (c *hetznerDNSProviderSolver) cleanUp(ch *v1alpha1.ChallengeRequest) (err error) {
+	start := time.Now()
+	var config internal.Config
+	ctx, span := internal.StartSpan(context.Background(), "CleanUp",
+		attribute.String("namespace", ch.ResourceNamespace),
+		attribute.String("fqdn", ch.ResolvedFQDN),
+	)
+	defer func() {
+		span.SetAttributes(attribute.String("zone", config.ZoneName))
+		internal.EndSpan(span, err)
+		internal.ObserveOperation("cleanup", config.ZoneName, start, err)
+	}()
+	logger := challengeLogger(ch).WithName("cleanup")
+	ctx = klog.NewContext(ctx, logger)
+	logger.V(6).Info("Starting CleanUp", "zone", ch.ResolvedZone)
+
+	events := c.challengeEvents(ch)
+	config, err = clientConfig(ctx, c, ch)
+
+	if err != nil {
+		if internal.IsZoneNotFound(err) {
+			events.Eventf(corev1.EventTypeWarning, internal.EventZoneNotFound, "No Hetzner zone found for %s: %v", ch.ResolvedFQDN, err)
+		}
+		return fmt.Errorf("unable to get secret `%s`; %w", ch.ResourceNamespace, err)
+	}
+	logger = logger.WithValues("zone", config.ZoneName)
+	ctx = klog.NewContext(ctx, logger)
 
+	unlock, err := c.lockRecord(ctx, config)
 	if err != nil {
-		return fmt.Errorf("unable to get secret `%s`; %v", ch.ResourceNamespace, err)
+		return err
 	}
+	defer unlock()
 
-	zoneId, err := searchZoneId(config)
+	if config.LegacyCleanup || c.ownership == nil {
+		return c.cleanUpByName(ctx, config, ch, events)
+	}
 
+	key := ownershipKey(ch)
+	owned, err := c.ownership.Get(ctx, key)
 	if err != nil {
-		return fmt.Errorf("unable to find id for zone name `%s`; %v", config.ZoneName, err)
+		return err
+	}
+	if len(owned) == 0 {
+		if !c.cleanupUntracked {
+			logger.Info("No TXT records owned by challenge, nothing to delete")
+			return nil
+		}
+		// Records presented before ownership tracking are only found by name and value
+		logger.Info("No TXT records owned by challenge, deleting by name and value")
+		return c.cleanUpByName(ctx, config, ch, events)
 	}
 
-	var url = config.ApiUrl + "/records?zone_id=" + zoneId
+	for _, record := range owned {
+		if record.ClusterId != c.clusterID {
+			logger.Info("Skipping TXT record created by another cluster", "record", record.RecordId, "clusterID", record.ClusterId)
+			continue
+		}
 
-	// Get all DNS records
-	dnsRecords, err := callDnsApi(url, "GET", nil, config)
+		if err := c.deleteRecord(ctx, config, ch, key, record, events); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dedupe runs fn for ch unless an identical operation for the same challenge is already in
+// flight, in which case its result is shared.
+func (c *hetznerDNSProviderSolver) dedupe(op string, ch *v1alpha1.ChallengeRequest, fn func(*v1alpha1.ChallengeRequest) error) error {
+	key := op + "/" + ownershipKey(ch) + "/" + ch.ResolvedFQDN + "/" + ch.Key
+	_, err, shared := c.inflight.Do(key, func() (interface{}, error) {
+		return nil, fn(ch)
+	})
+	if shared {
+		klog.V(4).InfoS("Shared result of concurrent call", "operation", op, "namespace", ch.ResourceNamespace, "fqdn", ch.ResolvedFQDN, "uid", ch.UID)
+	}
 
+	return err
+}
+
+// lockRecord serializes the read-modify-write sequences on the record of config, returning
+// the function releasing the lock. With record leases enabled, it waits for the Lease of
+// the record as well, for at most twice its duration.
+func (c *hetznerDNSProviderSolver) lockRecord(ctx context.Context, config internal.Config) (unlock func(), err error) {
+	name, err := internal.NormalizeDomain(config.Fqdn)
 	if err != nil {
-		return fmt.Errorf("unable to get DNS records %v", err)
+		name = config.Fqdn
 	}
+	key := config.ZoneName + "/" + name
 
-	// Unmarshall response
-	records := internal.RecordResponse{}
-	readErr := json.Unmarshal(dnsRecords, &records)
+	unlockLocal := c.recordLocks.Lock(key)
+	if c.recordLeases == nil {
+		return unlockLocal, nil
+	}
 
-	if readErr != nil {
-		return fmt.Errorf("unable to unmarshal response %v", readErr)
+	ctx, cancel := context.WithTimeout(ctx, 2*c.recordLeaseDuration)
+	defer cancel()
+	unlockLease, err := c.recordLeases.Lock(ctx, key)
+	if err != nil {
+		unlockLocal()
+		return nil, err
 	}
 
-	var recordId string
-	name := recordName(ch.ResolvedFQDN, config.ZoneName)
-	for i := len(records.Records) - 1; i >= 0; i-- {
-		if strings.EqualFold(records.Records[i].Name, name) {
-			recordId = records.Records[i].Id
-			break
-		}
+	return func() {
+		unlockLease()
+		unlockLocal()
+	}, nil
+}
+
+// lockOwnedRecord takes the lock of record that Present and CleanUp of its challenge take,
+// for changes made outside of a challenge.
+func (c *hetznerDNSProviderSolver) lockOwnedRecord(ctx context.Context, record internal.OwnedRecord) (unlock func(), err error) {
+	fqdn := record.ZoneName
+	if record.Name != "@" {
+		fqdn = record.Name + "." + record.ZoneName
 	}
 
-	// Delete TXT record
-	url = config.ApiUrl + "/records/" + recordId
-	del, err := callDnsApi(url, "DELETE", nil, config)
+	return c.lockRecord(ctx, internal.Config{ZoneName: record.ZoneName, Fqdn: fqdn})
+}
+
+// cleanUpByName deletes the TXT record matching the challenge name and key, regardless of
+// who created it.
+func (c *hetznerDNSProviderSolver) cleanUpByName(ctx context.Context, config internal.Config, ch *v1alpha1.ChallengeRequest, events *internal.ChallengeRecorder) error {
+	zoneId, err := searchZoneId(ctx, config)
 
 	if err != nil {
-		klog.Error(err)
+		return fmt.Errorf("unable to find id for zone name `%s`; %v", config.ZoneName, err)
+	}
+
+	records, err := backendFor(config).txtRecords(ctx, config, zoneId)
+	if err != nil {
+		forgetMissingZone(config, err)
+		return err
+	}
+
+	name := recordName(config.Fqdn, config.ZoneName)
+	for i := len(records) - 1; i >= 0; i-- {
+		// Delegated records can be shared by several challenges, so the value has to match too
+		if internal.EqualDomain(records[i].Name, name) && records[i].Value == ch.Key {
+			return c.deleteRecord(ctx, config, ch, "", c.ownedRecord(config, records[i], ch.Key), events)
+		}
 	}
-	klog.Infof("Delete TXT record result: %s", string(del))
+
+	klog.FromContext(ctx).Info("TXT record with the challenge key not found, nothing to delete", "name", name)
 	return nil
 }
 
+// deleteRecord deletes record of ch and forgets its ownership under key, if any. Failed
+// deletions are queued to be retried in the background.
+func (c *hetznerDNSProviderSolver) deleteRecord(ctx context.Context, config internal.Config, ch *v1alpha1.ChallengeRequest, key string, record internal.OwnedRecord, events *internal.ChallengeRecorder) error {
+	logger := klog.FromContext(ctx)
+	err := backendFor(config).deleteTxtRecord(ctx, config, record)
+
+	if err != nil && !internal.IsNotFound(err) {
+		c.auditChange(ctx, internal.AuditDelete, "cleanup", record, events, err)
+		logger.Error(err, "Unable to delete TXT record", "record", record.RecordId, "name", record.Name)
+		if c.deletions == nil {
+			events.Eventf(corev1.EventTypeWarning, internal.EventDeletionFailed, "Unable to delete TXT record %s in zone %s: %v", record.Name, record.ZoneName, err)
+			return nil
+		}
+		logger.Info("Queueing deletion of TXT record for retry", "record", record.RecordId)
+		events.Eventf(corev1.EventTypeWarning, internal.EventDeletionFailed, "Unable to delete TXT record %s in zone %s, retrying in the background: %v", record.Name, record.ZoneName, err)
+		return c.deletions.Enqueue(ctx, key, record, err, time.Now())
+	}
+	c.auditChange(ctx, internal.AuditDelete, "cleanup", record, events, nil)
+	events.Eventf(corev1.EventTypeNormal, internal.EventRecordDeleted, "Deleted TXT record %s in zone %s", record.Name, record.ZoneName)
+
+	if key != "" && c.ownership != nil {
+		return c.ownership.Remove(ctx, key, record.RecordId)
+	}
+	return nil
+}
+
+// ownedRecord describes record, created with value for the challenge configured by config,
+// for the ownership store and deletion queue.
+func (c *hetznerDNSProviderSolver) ownedRecord(config internal.Config, record internal.Record, value string) internal.OwnedRecord {
+	return internal.OwnedRecord{
+		ClusterId:       c.clusterID,
+		ZoneId:          record.ZoneId,
+		ZoneName:        config.ZoneName,
+		RecordId:        record.Id,
+		Name:            record.Name,
+		Value:           value,
+		Created:         time.Now().UTC(),
+		ApiUrl:          config.ApiUrl,
+		ApiFlavor:       config.ApiFlavor,
+		SecretNamespace: config.SecretNamespace,
+		SecretName:      config.SecretName,
+		SecretKey:       config.SecretKey,
+	}
+}
+
+// recordLabels returns the labels of the rrsets created by this webhook on the Cloud API.
+// The cluster ID is only added when it is a valid label value.
+func (c *hetznerDNSProviderSolver) recordLabels() map[string]string {
+	labels := map[string]string{"managed-by": "cert-manager-webhook-hetzner"}
+	if c.clusterID == "" {
+		return labels
+	}
+	if errs := validation.IsValidLabelValue(c.clusterID); len(errs) > 0 {
+		klog.InfoS("Cluster ID is not a valid label value, not labelling records with it", "clusterID", c.clusterID, "reasons", strings.Join(errs, "; "))
+		return labels
+	}
+	labels["cluster-id"] = c.clusterID
+	return labels
+}
+
+// challengeEvents returns the recorder of events on the Challenge of ch.
+func (c *hetznerDNSProviderSolver) challengeEvents(ch *v1alpha1.ChallengeRequest) *internal.ChallengeRecorder {
+	return c.events.For(ch.DNSName, ch.Key)
+}
+
+// challengeLogger returns the logger of the calls for ch, with secrets redacted.
+func challengeLogger(ch *v1alpha1.ChallengeRequest) klog.Logger {
+	return internal.NewLogger().WithValues("namespace", ch.ResourceNamespace, "fqdn", ch.ResolvedFQDN, "uid", ch.UID)
+}
+
+// ownershipKey returns the key under which the records created for ch are tracked.
+func ownershipKey(ch *v1alpha1.ChallengeRequest) string {
+	return internal.OwnershipKey(ch.ResourceNamespace, ch.ResolvedFQDN, ch.Key)
+}
+
 func (c *hetznerDNSProviderSolver) Initialize(kubeClientConfig *rest.Config, stopCh <-chan struct{}) error {
 	k8sClient, err := kubernetes.NewForConfig(kubeClientConfig)
-	klog.V(6).Infof("Input variable stopCh is %d length", len(stopCh))
 	if err != nil {
 		return err
 	}
 
 	c.client = k8sClient
+	c.clusterID = os.Getenv("CLUSTER_ID")
+	if v := os.Getenv("CLEANUP_UNTRACKED"); v != "" {
+		if c.cleanupUntracked, err = strconv.ParseBool(v); err != nil {
+			return fmt.Errorf("invalid CLEANUP_UNTRACKED `%s`; %v", v, err)
+		}
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(kubeClientConfig)
+	if err != nil {
+		return err
+	}
+	c.events = internal.NewChallengeEvents(dynamicClient, internal.NewEventRecorder(k8sClient))
+	c.events.Start(stopCh)
+
+	ownershipConfigMap := os.Getenv("OWNERSHIP_CONFIGMAP")
+	if ownershipConfigMap == "" {
+		ownershipConfigMap = defaultOwnershipConfigMap
+	}
+	c.ownership = internal.NewOwnershipStore(k8sClient, webhookNamespace(), ownershipConfigMap)
+
+	deletionQueueConfigMap := os.Getenv("DELETION_QUEUE_CONFIGMAP")
+	if deletionQueueConfigMap == "" {
+		deletionQueueConfigMap = defaultDeletionQueueConfigMap
+	}
+	c.deletions = internal.NewDeletionQueue(k8sClient, webhookNamespace(), deletionQueueConfigMap)
+
+	retryOpts, err := deletionRetryOptionsFromEnv()
+	if err != nil {
+		return err
+	}
+	gcOpts, err := gcOptionsFromEnv()
+	if err != nil {
+		return err
+	}
+	coordination, err := coordinationOptionsFromEnv()
+	if err != nil {
+		return err
+	}
+
+	auditOpts, err := auditOptionsFromEnv()
+	if err != nil {
+		return err
+	}
+	if c.audit, err = newAuditLog(k8sClient, auditOpts); err != nil {
+		return err
+	}
+
+	healthOpts, err := healthOptionsFromEnv()
+	if err != nil {
+		return err
+	}
+	if c.health == nil {
+		c.health = internal.NewAPIHealth(healthCheckTimeout)
+	}
+	if err := c.startHealthChecks(healthOpts, stopCh); err != nil {
+		return err
+	}
+
+	if coordination.RecordLeases {
+		c.recordLeases = internal.NewLeaseLocker(k8sClient, webhookNamespace(), podIdentity(), coordination.RecordLeaseDuration)
+		c.recordLeaseDuration = coordination.RecordLeaseDuration
+	}
+
+	backgroundJobs := func(stopCh <-chan struct{}) {
+		go c.runDeletionQueue(retryOpts, stopCh)
+		if gcOpts.Interval > 0 {
+			go c.runGarbageCollector(gcOpts, stopCh)
+		}
+	}
+	if coordination.LeaderElection {
+		go runAsLeader(k8sClient, coordination, stopCh, backgroundJobs)
+	} else {
+		backgroundJobs(stopCh)
+	}
 
 	return nil
 }
 
+// webhookNamespace returns the namespace the webhook runs in, which holds its own state.
+func webhookNamespace() string {
+	if namespace := os.Getenv("POD_NAMESPACE"); namespace != "" {
+		return namespace
+	}
+	if namespace, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace"); err == nil {
+		return strings.TrimSpace(string(namespace))
+	}
+	return "default"
+}
+
 func loadConfig(cfgJSON *extapi.JSON) (hetznerDNSProviderConfig, error) {
 	cfg := hetznerDNSProviderConfig{}
 	// handle the 'base case' where no configuration has been provided
@@ -138,9 +609,133 @@ func loadConfig(cfgJSON *extapi.JSON) (hetznerDNSProviderConfig, error) {
 		return cfg, fmt.Errorf("error decoding solver config: %v", err)
 	}
 
+	switch cfg.ZoneMismatchPolicy {
+	case "":
+		cfg.ZoneMismatchPolicy = zoneMismatchFail
+	case zoneMismatchFail, zoneMismatchDiscover:
+	default:
+		return cfg, fmt.Errorf("invalid zoneMismatchPolicy `%s`, expected `%s` or `%s`",
+			cfg.ZoneMismatchPolicy, zoneMismatchFail, zoneMismatchDiscover)
+	}
+
+	flavors := []string{cfg.ApiFlavor}
+	for _, zone := range cfg.Zones {
+		flavors = append(flavors, zone.ApiFlavor)
+	}
+	for _, flavor := range flavors {
+		switch flavor {
+		case "", internal.ApiFlavorLegacy, internal.ApiFlavorCloud:
+		default:
+			return cfg, fmt.Errorf("invalid apiFlavor `%s`, expected `%s` or `%s`",
+				flavor, internal.ApiFlavorLegacy, internal.ApiFlavorCloud)
+		}
+	}
+
 	return cfg, nil
 }
 
+// challengeFqdn returns the FQDN the TXT record for ch is written to: the target of a
+// matching delegation, the CNAME target of ch.ResolvedFQDN when FollowCNAME is enabled,
+// otherwise ch.ResolvedFQDN itself.
+func challengeFqdn(ctx context.Context, cfg hetznerDNSProviderConfig, ch *v1alpha1.ChallengeRequest) (string, error) {
+	domain := ch.DNSName
+	if domain == "" {
+		domain = strings.TrimPrefix(ch.ResolvedFQDN, "_acme-challenge.")
+	}
+	if target, ok := internal.MatchDelegation(domain, cfg.Delegations); ok {
+		klog.FromContext(ctx).Info("Delegating challenge", "domain", domain, "target", target)
+		return target, nil
+	}
+
+	if !cfg.FollowCNAME {
+		return ch.ResolvedFQDN, nil
+	}
+
+	_, span := internal.StartSpan(ctx, "cname follow", attribute.String("fqdn", ch.ResolvedFQDN))
+	resolver := &internal.CNAMEResolver{Nameservers: cfg.Nameservers}
+	target, err := resolver.Follow(ch.ResolvedFQDN)
+	span.SetAttributes(attribute.String("target", target))
+	internal.EndSpan(span, err)
+	if err != nil {
+		return "", fmt.Errorf("unable to follow CNAME of `%s`; %v", ch.ResolvedFQDN, err)
+	}
+
+	if len(cfg.AllowedZones) > 0 && internal.MostSpecificZone(target, cfg.AllowedZones) < 0 {
+		return "", fmt.Errorf("CNAME target `%s` of `%s` is outside the allowed zones %v", target, ch.ResolvedFQDN, cfg.AllowedZones)
+	}
+	if !internal.EqualDomain(target, ch.ResolvedFQDN) {
+		klog.FromContext(ctx).Info("Following CNAME", "target", target)
+	}
+
+	return target, nil
+}
+
+// forFqdn returns the configuration to use for fqdn, merging the most specific entry
+// of Zones into the top-level settings. Without a matching entry the top-level
+// settings are returned unchanged.
+func (cfg hetznerDNSProviderConfig) forFqdn(fqdn string) hetznerDNSProviderConfig {
+	names := make([]string, len(cfg.Zones))
+	for i, zone := range cfg.Zones {
+		names[i] = zone.ZoneName
+		if names[i] == "" {
+			names[i] = zone.Suffix
+		}
+	}
+
+	i := internal.MostSpecificZone(fqdn, names)
+	if i < 0 {
+		return cfg
+	}
+
+	zone := cfg.Zones[i]
+	klog.V(4).InfoS("Using zones entry", "entry", names[i], "fqdn", fqdn)
+
+	// A suffix entry leaves the zone name empty so that it is searched in the API
+	cfg.ZoneName = zone.ZoneName
+	if zone.SecretRef != "" {
+		cfg.SecretRef = zone.SecretRef
+	}
+	if zone.SecretKey != "" {
+		cfg.SecretKey = zone.SecretKey
+	}
+	if zone.ApiUrl != "" {
+		cfg.ApiUrl = zone.ApiUrl
+		// The flavor of the top-level API does not apply to another API
+		cfg.ApiFlavor = ""
+	}
+	if zone.ApiFlavor != "" {
+		cfg.ApiFlavor = zone.ApiFlavor
+	}
+	cfg.Zones = nil
+
+	return cfg
+}
+
+// secretValue returns the value of key in the secret namespace/name.
+func (c *hetznerDNSProviderSolver) secretValue(ctx context.Context, namespace, name, key string) (_ string, err error) {
+	ctx, span := internal.StartSpan(ctx, "secret lookup", attribute.String("namespace", namespace), attribute.String("secret", name))
+	defer func() { internal.EndSpan(span, err) }()
+
+	if c.apiToken != "" {
+		return c.apiToken, nil
+	}
+
+	sec, err := c.client.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+
+	if err != nil {
+		return "", fmt.Errorf("unable to get secret `%s/%s`; %v", name, namespace, err)
+	}
+
+	value, err := stringFromSecretData(sec.Data, key)
+
+	if err != nil {
+		return "", fmt.Errorf("unable to get %s from secret `%s/%s`; %v", key, name, namespace, err)
+	}
+	internal.RegisterSecret(value)
+
+	return value, nil
+}
+
 func stringFromSecretData(secretData map[string][]byte, key string) (string, error) {
 	data, ok := secretData[key]
 	if !ok {
@@ -149,74 +744,119 @@ func stringFromSecretData(secretData map[string][]byte, key string) (string, err
 	return string(data), nil
 }
 
-func addTxtRecord(config internal.Config, ch *v1alpha1.ChallengeRequest) {
-	url := config.ApiUrl + "/records"
+// addTxtRecord adds the challenge key of ch in the zone of config, recording the change in
+// the audit log with the Challenge of events.
+func (c *hetznerDNSProviderSolver) addTxtRecord(ctx context.Context, config internal.Config, ch *v1alpha1.ChallengeRequest, labels map[string]string, events *internal.ChallengeRecorder) (internal.Record, error) {
+	name := recordName(config.Fqdn, config.ZoneName)
+	if name == "" {
+		return internal.Record{}, fmt.Errorf("unable to determine record name for `%s` in zone `%s`", config.Fqdn, config.ZoneName)
+	}
 
-	name := recordName(ch.ResolvedFQDN, config.ZoneName)
-	zoneId, err := searchZoneId(config)
+	zoneId, err := searchZoneId(ctx, config)
 
 	if err != nil {
-		klog.Errorf("unable to find id for zone name `%s`; %v", config.ZoneName, err)
+		return internal.Record{}, fmt.Errorf("unable to find id for zone name `%s`; %v", config.ZoneName, err)
+	}
+	if zoneId == "" {
+		return internal.Record{}, &internal.ZoneNotFoundError{Domain: config.ZoneName}
 	}
 
-	var jsonStr = fmt.Sprintf(`{"value":%q, "ttl":120, "type":"TXT", "name":%q, "zone_id":%q}`, ch.Key, name, zoneId)
-
-	add, err := callDnsApi(url, "POST", bytes.NewBuffer([]byte(jsonStr)), config)
+	record, err := backendFor(config).addTxtRecord(ctx, config, zoneId, name, ch.Key, labels)
+	forgetMissingZone(config, err)
+	audited := c.ownedRecord(config, record, ch.Key)
+	audited.Name = name
+	c.auditChange(ctx, internal.AuditCreate, "present", audited, events, err)
 
-	if err != nil {
-		klog.Error(err)
-	}
-	klog.Infof("Added TXT record result: %s", string(add))
+	return record, err
 }
 
-func clientConfig(c *hetznerDNSProviderSolver, ch *v1alpha1.ChallengeRequest) (internal.Config, error) {
-	var config internal.Config
+func clientConfig(ctx context.Context, c *hetznerDNSProviderSolver, ch *v1alpha1.ChallengeRequest) (internal.Config, error) {
+	logger := klog.FromContext(ctx)
 
-	cfg, err := loadConfig(ch.Config)
+	config, cfg, err := apiConfig(ctx, c, ch)
 	if err != nil {
 		return config, err
 	}
-	config.ZoneName = cfg.ZoneName
-	config.ApiUrl = cfg.ApiUrl
-
-	secretName := cfg.SecretRef
-	sec, err := c.client.CoreV1().Secrets(ch.ResourceNamespace).Get(context.TODO(), secretName, metav1.GetOptions{})
 
-	if err != nil {
-		return config, fmt.Errorf("unable to get secret `%s/%s`; %v", secretName, ch.ResourceNamespace, err)
+	if config.ZoneName != "" {
+		config.ZoneName, err = internal.NormalizeDomain(config.ZoneName)
+		if err != nil {
+			return config, err
+		}
 	}
 
-	apiKey, err := stringFromSecretData(sec.Data, "api-key")
-	config.ApiKey = apiKey
-
-	if err != nil {
-		return config, fmt.Errorf("unable to get api-key from secret `%s/%s`; %v", secretName, ch.ResourceNamespace, err)
+	// A configured ZoneName that does not contain the FQDN would produce an empty record name
+	if config.ZoneName != "" && !internal.IsInZone(config.Fqdn, config.ZoneName) {
+		if cfg.ZoneMismatchPolicy != zoneMismatchDiscover {
+			return config, fmt.Errorf("FQDN `%s` is not part of the configured zone `%s`", config.Fqdn, config.ZoneName)
+		}
+		logger.Info("FQDN is not part of the configured zone, searching the zone instead", "recordFqdn", config.Fqdn, "configuredZone", config.ZoneName)
+		config.ZoneName = ""
 	}
 
 	// Get ZoneName by api search if not provided by config
 	if config.ZoneName == "" {
-		// Use ch.ResolvedZone which should be the FQDN minus the challenge part
+		// Use ch.ResolvedZone which should be the FQDN minus the challenge part,
+		// or the CNAME target itself when the record was delegated elsewhere
 		searchDomain := ch.ResolvedZone
+		if !internal.EqualDomain(config.Fqdn, ch.ResolvedFQDN) {
+			searchDomain = config.Fqdn
+		}
 		// Ensure searchDomain has a trailing dot for consistency, although searchZoneName handles it
 		if !strings.HasSuffix(searchDomain, ".") {
 			searchDomain += "."
 		}
-		klog.V(4).Infof("ZoneName not provided, attempting to search using: %s", searchDomain)
-		foundZone, err := searchZoneName(config, searchDomain)
+		logger.V(4).Info("ZoneName not provided, searching the zone", "domain", searchDomain)
+		foundZone, err := searchZoneName(ctx, config, searchDomain)
 		if err != nil {
-			return config, fmt.Errorf("error searching for zone for %s: %v", searchDomain, err)
+			return config, fmt.Errorf("error searching for zone for %s: %w", searchDomain, err)
 		}
 		config.ZoneName = foundZone
-		klog.V(2).Infof("Found ZoneName '%s' for domain '%s'", foundZone, searchDomain)
+		logger.V(2).Info("Found zone", "zone", foundZone, "domain", searchDomain)
+	}
+
+	return config, nil
+}
+
+// apiConfig returns the config of the API and the record used for ch, with the zone name
+// as configured, and the solver config it was derived from.
+func apiConfig(ctx context.Context, c *hetznerDNSProviderSolver, ch *v1alpha1.ChallengeRequest) (internal.Config, hetznerDNSProviderConfig, error) {
+	var config internal.Config
+	logger := klog.FromContext(ctx)
+
+	cfg, err := loadConfig(ch.Config)
+	if err != nil {
+		return config, cfg, err
+	}
+	config.Fqdn, err = challengeFqdn(ctx, cfg, ch)
+	if err != nil {
+		return config, cfg, err
 	}
+	cfg = cfg.forFqdn(config.Fqdn)
+	config.ZoneName = cfg.ZoneName
+	config.ApiUrl = cfg.ApiUrl
+	config.LegacyCleanup = cfg.LegacyCleanup
 
 	// Default API URL if not provided
 	if config.ApiUrl == "" {
 		config.ApiUrl = "https://api.hetzner.cloud/v1"
-		klog.V(4).Infof("ApiUrl not provided, using default: %s", config.ApiUrl)
+		logger.V(4).Info("ApiUrl not provided, using default", "apiUrl", config.ApiUrl)
 	}
+	config.ApiFlavor = internal.ApiFlavor(cfg.ApiFlavor, config.ApiUrl)
 
-	return config, nil
+	config.SecretNamespace = ch.ResourceNamespace
+	config.SecretName = cfg.SecretRef
+	config.SecretKey = cfg.SecretKey
+	if config.SecretKey == "" {
+		config.SecretKey = "api-key"
+	}
+
+	config.ApiKey, err = c.secretValue(ctx, config.SecretNamespace, config.SecretName, config.SecretKey)
+	if err != nil {
+		return config, cfg, err
+	}
+
+	return config, cfg, nil
 }
 
 /*
@@ -229,13 +869,21 @@ record name and is separated by "."
 // Example: fqdn = _acme-challenge.example.com., domain = example.com. -> _acme-challenge
 // Example: fqdn = example.com., domain = example.com. -> @ (Hetzner uses @ for the zone apex record name)
 func recordName(fqdn, domain string) string {
-	// Normalize by removing trailing dots, which might be present in FQDNs/Zones
-	fqdnNormalized := strings.TrimSuffix(fqdn, ".")
-	domainNormalized := strings.TrimSuffix(domain, ".")
+	// Normalize to lowercase punycode without trailing dots, the form stored by the Hetzner API
+	fqdnNormalized, err := internal.NormalizeDomain(fqdn)
+	if err != nil {
+		klog.ErrorS(nil, "Unable to normalize FQDN", "fqdn", fqdn, "reason", err.Error())
+		return ""
+	}
+	domainNormalized, err := internal.NormalizeDomain(domain)
+	if err != nil {
+		klog.ErrorS(nil, "Unable to normalize zone name", "zone", domain, "reason", err.Error())
+		return ""
+	}
 
 	// Handle apex domain case (though unlikely for ACME challenges which are prefixed)
 	if fqdnNormalized == domainNormalized {
-		klog.V(4).Infof("recordName: FQDN '%s' matches domain '%s', returning '@' for apex.", fqdn, domain)
+		klog.V(4).InfoS("FQDN is the zone apex, using record name '@'", "fqdn", fqdn, "zone", domain)
 		return "@"
 	}
 
@@ -247,126 +895,133 @@ func recordName(fqdn, domain string) string {
 		record := strings.TrimSuffix(fqdnNormalized, suffix)
 		// Ensure record is not empty after trimming (shouldn't happen with _acme-challenge)
 		if record == "" {
-			klog.Errorf("recordName: FQDN '%s' resulted in empty record name after trimming zone '%s'. This is unexpected.", fqdn, domain)
+			klog.ErrorS(nil, "FQDN resulted in an empty record name after trimming the zone", "fqdn", fqdn, "zone", domain)
 			return "" // Return empty string on unexpected result
 		}
-		klog.V(4).Infof("recordName: FQDN '%s', domain '%s', extracted record name '%s'", fqdn, domain, record)
+		klog.V(4).InfoS("Extracted record name", "fqdn", fqdn, "zone", domain, "name", record)
 		return record
 	}
 
 	// If it doesn't end with the expected suffix, the zone/FQDN combination is likely incorrect.
-	klog.Errorf("recordName: FQDN '%s' does not seem to belong to zone '%s'. Returning empty string.", fqdn, domain)
+	klog.ErrorS(nil, "FQDN does not belong to the zone", "fqdn", fqdn, "zone", domain)
 	return ""
 }
 
-func callDnsApi(url, method string, body io.Reader, config internal.Config) ([]byte, error) {
-	ctx := context.Background()
-	req, err := http.NewRequestWithContext(ctx, method, url, body)
-	if err != nil {
-		return []byte{}, fmt.Errorf("unable to execute request %v", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer " + config.ApiKey)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
+func callDnsApi(ctx context.Context, url, method string, body io.Reader, config internal.Config) ([]byte, error) {
+	// The body is sent again when a rate limited request is retried
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = io.ReadAll(body); err != nil {
+			return []byte{}, fmt.Errorf("unable to read request body %v", err)
+		}
 	}
 
-	defer func() {
-		err := resp.Body.Close()
+	for attempt := 1; ; attempt++ {
+		respBody, resp, err := callDnsApiOnce(ctx, url, method, payload, config, attempt)
 		if err != nil {
-			klog.Fatal(err)
+			return nil, err
 		}
-	}()
 
-	respBody, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode == http.StatusOK {
-		return respBody, nil
-	}
+		if resp.StatusCode == http.StatusTooManyRequests && attempt <= maxThrottleRetries {
+			wait := internal.RetryAfter(resp.Header.Get("Retry-After"), time.Now(), maxThrottleWait)
+			klog.FromContext(ctx).Info("Rate limited by the Hetzner API, retrying", "method", method, "path", resp.Request.URL.Path, "wait", wait)
+			internal.ObserveThrottleWait(wait)
+			select {
+			case <-ctx.Done():
+				return nil, fmt.Errorf("unable to retry rate limited request to `%s`; %v", url, ctx.Err())
+			case <-time.After(wait):
+			}
+			continue
+		}
 
-	text := "Error calling API status:" + resp.Status + " url: " + url + " method: " + method
-	klog.Error(text)
-	return nil, errors.New(text)
+		// The Cloud API answers 201 for created resources and started actions
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return respBody, nil
+		}
+
+		klog.FromContext(ctx).Error(nil, "Hetzner API request failed", "method", method, "path", resp.Request.URL.Path, "status", resp.StatusCode)
+		return nil, &internal.APIError{StatusCode: resp.StatusCode, Status: resp.Status, Url: url, Method: method}
+	}
 }
 
-func searchZoneId(config internal.Config) (string, error) {
-	url := config.ApiUrl + "/zones?name=" + config.ZoneName
+// callDnsApiOnce sends a single request to the API, traced in a span of its own.
+func callDnsApiOnce(ctx context.Context, url, method string, payload []byte, config internal.Config, attempt int) (_ []byte, _ *http.Response, err error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to execute request %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+config.ApiKey)
 
-	// Get Zone configuration
-	zoneRecords, err := callDnsApi(url, "GET", nil, config)
+	endpoint := internal.EndpointLabel(req.URL.Path)
+	ctx, span := internal.StartSpan(ctx, method+" "+endpoint,
+		attribute.String("http.request.method", method),
+		attribute.String("url.path", endpoint),
+		attribute.Int("http.request.resend_count", attempt-1),
+	)
+	defer func() { internal.EndSpan(span, err) }()
 
+	client := &http.Client{}
+	start := time.Now()
+	resp, err := client.Do(req.WithContext(ctx))
 	if err != nil {
-		// Propagate API call errors
-		return "", fmt.Errorf("API error getting zone info for '%s': %v", config.ZoneName, err)
+		internal.ObserveAPIRequest(method, req.URL.Path, 0, start)
+		return nil, nil, err
 	}
 
-	// Unmarshall response
-	zones := internal.ZoneResponse{}
-	readErr := json.Unmarshal(zoneRecords, &zones)
-
-	if readErr != nil {
-		return "", fmt.Errorf("unable to unmarshal zone response for '%s': %v", config.ZoneName, readErr)
+	respBody, _ := io.ReadAll(resp.Body)
+	if err := resp.Body.Close(); err != nil {
+		klog.Fatal(err)
+	}
+	internal.ObserveAPIRequest(method, req.URL.Path, resp.StatusCode, start)
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= 400 {
+		span.SetStatus(codes.Error, resp.Status)
 	}
 
-	// Check the number of zones returned
-	if zones.Meta.Pagination.TotalEntries == 0 {
-		// Explicitly return empty string and nil error if zone is not found
-		return "", nil
+	return respBody, resp, nil
+}
+
+// searchZoneId returns the id of the zone config.ZoneName, or an empty string when it
+// does not exist.
+// Found zones are cached for zoneCacheTTL.
+func searchZoneId(ctx context.Context, config internal.Config) (_ string, err error) {
+	ctx, span := internal.StartSpan(ctx, "zone lookup", attribute.String("zone", config.ZoneName))
+	defer func() { internal.EndSpan(span, err) }()
+
+	key := internal.ZoneCacheKey(config, config.ZoneName)
+	id, ok := zoneCache.Get(key, time.Now())
+	span.SetAttributes(attribute.Bool("cache_hit", ok))
+	if ok {
+		return id, nil
 	}
 
-	if zones.Meta.Pagination.TotalEntries > 1 {
-		// This case should ideally not happen if Hetzner API guarantees unique zone names
-		klog.Warningf("Found multiple zones (%d) for name '%s', using the first one.", zones.Meta.Pagination.TotalEntries, config.ZoneName)
-		// Return error as this is unexpected
-		return "", fmt.Errorf("unexpected number of zones (%d) found for name '%s'", zones.Meta.Pagination.TotalEntries, config.ZoneName)
+	id, err = backendFor(config).zoneId(ctx, config)
+	if err == nil && id != "" {
+		zoneCache.Put(key, id, time.Now())
 	}
+	return id, err
+}
 
-	// Exactly one zone found
-	return zones.Zones[0].Id, nil
+// forgetMissingZone evicts the cached id of config.ZoneName when a record call failed
+// because the zone no longer exists, so that the next challenge looks it up again.
+func forgetMissingZone(config internal.Config, err error) {
+	if internal.IsNotFound(err) {
+		zoneCache.Forget(internal.ZoneCacheKey(config, config.ZoneName))
+	}
 }
 
 // searchZoneName attempts to find the correct Hetzner zone name for a given FQDN (searchZone)
 // by iteratively querying parent domains. searchZone should typically be the value from
 // ChallengeRequest.ResolvedZone.
-func searchZoneName(config internal.Config, searchZone string) (string, error) {
-	// Normalize searchZone by removing any potential trailing dot
-	normalizedSearchZone := strings.TrimSuffix(searchZone, ".")
-	parts := strings.Split(normalizedSearchZone, ".")
-
-	// Need at least 2 parts (e.g., domain.com) to form a potential zone
-	if len(parts) < 2 {
-		return "", fmt.Errorf("unable to determine potential zones from searchZone: %s", searchZone)
-	}
+func searchZoneName(ctx context.Context, config internal.Config, searchZone string) (_ string, err error) {
+	ctx, span := internal.StartSpan(ctx, "zone search", attribute.String("domain", searchZone))
+	defer func() { internal.EndSpan(span, err) }()
 
-	// Iterate from the most specific potential zone (e.g., sub.domain.com)
-	// down to the least specific (e.g., domain.com).
-	// The loop goes from i=0 (full domain) up to len(parts)-2 (TLD+1).
-	for i := 0; i <= len(parts)-2; i++ {
-		potentialZoneName := strings.Join(parts[i:], ".")
+	return internal.SearchZoneName(searchZone, func(zoneName string) (string, error) {
 		// Temporarily set ZoneName in config for searchZoneId call
-		config.ZoneName = potentialZoneName
-		zoneId, err := searchZoneId(config) // Capture error
-
-		if err != nil {
-			// Log the error from searchZoneId (e.g., API error, unexpected multiple zones)
-			// but continue searching parent domains as the error might be specific to this level.
-			klog.Warningf("Error searching for zone ID for '%s': %v. Trying parent domain.", potentialZoneName, err)
-			// Continue to the next iteration (parent domain)
-		}
-
-		if zoneId != "" {
-			// Found the zone successfully
-			klog.Infof("Found ZoneName: %s (searched using FQDN: %s)", potentialZoneName, searchZone)
-			return potentialZoneName, nil
-		}
-
-		// If zoneId is empty and err was nil, it means the zone wasn't found at this level.
-		// Continue to the parent domain.
-		klog.V(4).Infof("Zone '%s' not found via API, trying parent.", potentialZoneName)
-	}
-
-	// If the loop completes without finding a zone ID for any potential zone name
-	return "", fmt.Errorf("unable to find a registered Hetzner DNS zone for domain: %s or its parents", searchZone)
+		config.ZoneName = zoneName
+		return searchZoneId(ctx, config)
+	})
 }
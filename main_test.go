@@ -4,8 +4,11 @@ import (
 	"math/rand"
 	"os"
 	"testing"
+	"time"
 
 	dns "github.com/cert-manager/cert-manager/test/acme"
+	"github.com/trijpstra-fourlights/cert-manager-webhook-hetzner/internal"
+	"github.com/trijpstra-fourlights/cert-manager-webhook-hetzner/internal/hetznertest"
 )
 
 var (
@@ -13,7 +16,18 @@ var (
 	fqdn string
 )
 
+const (
+	// offlineZone and offlineToken are served by the fake Hetzner API of the offline
+	// suite, the token matches testdata/hetzner-offline/hetzner-secret.yml.
+	offlineZone  = "example.com"
+	offlineToken = "offline-test-token"
+)
+
 func TestRunsSuite(t *testing.T) {
+	if zone == "" {
+		t.Skip("TEST_ZONE_NAME is not set, only running the offline suite")
+	}
+
 	// The manifest path should contain a file named config.json that is a
 	// snippet of valid configuration that should be included on the
 	// ChallengeRequest passed as part of the test cases.
@@ -31,6 +45,43 @@ func TestRunsSuite(t *testing.T) {
 	fixture.RunConformance(t)
 }
 
+// TestRunsSuiteOffline runs the conformance suite against the fake Hetzner API of both
+// flavors, checking the records through a local DNS server answering from the fake.
+func TestRunsSuiteOffline(t *testing.T) {
+	// Initialize must not reach out to the real Hetzner API or run background jobs
+	t.Setenv("HEALTH_CHECK_API_URLS", "")
+	t.Setenv("GC_INTERVAL", "0")
+	t.Setenv("LEADER_ELECTION", "false")
+
+	for _, flavor := range []string{internal.ApiFlavorLegacy, internal.ApiFlavorCloud} {
+		t.Run(flavor, func(t *testing.T) {
+			fake := hetznertest.NewServer(t, offlineToken)
+			fake.AddZone(hetznertest.Zone{Name: offlineZone})
+			nameserver := fake.StartDNS(t)
+
+			fixture := dns.NewFixture(&hetznerDNSProviderSolver{},
+				dns.SetResolvedZone(offlineZone+"."),
+				dns.SetResolvedFQDN(GetRandomString(20)+"."+offlineZone+"."),
+				dns.SetAllowAmbientCredentials(false),
+				dns.SetManifestPath("testdata/hetzner-offline"),
+				dns.SetConfig(map[string]string{
+					"secretName": "hetzner-secret",
+					"zoneName":   offlineZone,
+					"apiUrl":     fake.URL(flavor),
+					"apiFlavor":  flavor,
+				}),
+				dns.SetDNSServer(nameserver),
+				dns.SetUseAuthoritative(false),
+				dns.SetStrict(true),
+				dns.SetPollInterval(100*time.Millisecond),
+				dns.SetPropagationLimit(10*time.Second),
+			)
+
+			fixture.RunConformance(t)
+		})
+	}
+}
+
 func GetRandomString(n int) string {
 	letters := []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
 
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/trijpstra-fourlights/cert-manager-webhook-hetzner/internal"
+	"k8s.io/klog/v2"
+)
+
+// serveMetrics serves the Prometheus metrics of the webhook on address until ctx is done.
+func serveMetrics(ctx context.Context, address string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", internal.MetricsHandler())
+
+	serveHTTP(ctx, "metrics", address, mux)
+}
+
+// serveHTTP serves handler on address until ctx is done. name identifies the server in
+// logs.
+func serveHTTP(ctx context.Context, name, address string, handler http.Handler) {
+	server := &http.Server{Addr: address, Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		if err := server.Shutdown(context.Background()); err != nil {
+			klog.ErrorS(err, "Unable to shut down server", "server", name)
+		}
+	}()
+
+	klog.InfoS("Serving", "server", name, "address", address)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		klog.ErrorS(err, "Server failed", "server", name, "address", address)
+	}
+}
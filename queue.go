@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/trijpstra-fourlights/cert-manager-webhook-hetzner/internal"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+// deletionRetryOptions configures the background retries of failed deletions.
+type deletionRetryOptions struct {
+	// Interval between two checks for due deletions.
+	Interval time.Duration
+	// Expiry after which a deletion that keeps failing is given up.
+	Expiry time.Duration
+}
+
+// deletionRetryOptionsFromEnv reads the retry options from DELETION_RETRY_INTERVAL and
+// DELETION_RETRY_EXPIRY.
+func deletionRetryOptionsFromEnv() (deletionRetryOptions, error) {
+	opts := deletionRetryOptions{Interval: time.Minute, Expiry: 72 * time.Hour}
+
+	var err error
+	if v := os.Getenv("DELETION_RETRY_INTERVAL"); v != "" {
+		if opts.Interval, err = time.ParseDuration(v); err != nil {
+			return opts, fmt.Errorf("invalid DELETION_RETRY_INTERVAL `%s`; %v", v, err)
+		}
+	}
+	if v := os.Getenv("DELETION_RETRY_EXPIRY"); v != "" {
+		if opts.Expiry, err = time.ParseDuration(v); err != nil {
+			return opts, fmt.Errorf("invalid DELETION_RETRY_EXPIRY `%s`; %v", v, err)
+		}
+	}
+	if opts.Interval <= 0 {
+		return opts, fmt.Errorf("DELETION_RETRY_INTERVAL must be positive, got `%s`", opts.Interval)
+	}
+
+	return opts, nil
+}
+
+// runDeletionQueue retries due deletions every opts.Interval until stopCh is closed.
+func (c *hetznerDNSProviderSolver) runDeletionQueue(opts deletionRetryOptions, stopCh <-chan struct{}) {
+	logger := internal.NewLogger().WithName("deletion-queue")
+	logger.Info("Starting deletion retry queue", "interval", opts.Interval, "expiry", opts.Expiry)
+	wait.Until(func() {
+		if err := c.retryDeletions(klog.NewContext(context.TODO(), logger), opts); err != nil {
+			logger.Error(err, "Retrying queued deletions failed")
+		}
+	}, opts.Interval, stopCh)
+}
+
+// retryDeletions attempts every due deletion once, rescheduling failures with backoff and
+// giving up on deletions queued longer than opts.Expiry.
+func (c *hetznerDNSProviderSolver) retryDeletions(ctx context.Context, opts deletionRetryOptions) error {
+	logger := klog.FromContext(ctx)
+	now := time.Now()
+	due, err := c.deletions.Due(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	for _, pending := range due {
+		if now.Sub(pending.Enqueued) > opts.Expiry {
+			logger.Error(nil, "Giving up deleting TXT record", "record", pending.RecordId, "name", pending.Name,
+				"zone", pending.ZoneName, "attempts", pending.Attempts, "lastError", pending.LastError)
+			if err := c.deletions.Done(ctx, pending.RecordId); err != nil {
+				return err
+			}
+			continue
+		}
+
+		err := c.retryDeletion(ctx, pending)
+		if err == nil {
+			logger.Info("Deleted queued TXT record", "record", pending.RecordId, "name", pending.Name,
+				"zone", pending.ZoneName, "failedAttempts", pending.Attempts)
+			if err := c.deletions.Done(ctx, pending.RecordId); err != nil {
+				return err
+			}
+			continue
+		}
+
+		logger.Error(err, "Retrying deletion of TXT record failed", "record", pending.RecordId)
+		if err := c.deletions.Retry(ctx, pending.RecordId, err, now); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// retryDeletion deletes a queued record and forgets its ownership. A record that no longer
+// exists counts as deleted.
+func (c *hetznerDNSProviderSolver) retryDeletion(ctx context.Context, pending internal.PendingDeletion) error {
+	config := internal.Config{ApiUrl: pending.ApiUrl, ApiFlavor: pending.ApiFlavor}
+
+	var err error
+	config.ApiKey, err = c.secretValue(ctx, pending.SecretNamespace, pending.SecretName, pending.SecretKey)
+	if err != nil {
+		return err
+	}
+
+	// Like CleanUp, as a challenge for the same name may be changing the record concurrently
+	unlock, err := c.lockOwnedRecord(ctx, pending.OwnedRecord)
+	if err != nil {
+		return err
+	}
+	err = backendFor(config).deleteTxtRecord(ctx, config, pending.OwnedRecord)
+	unlock()
+	if internal.IsNotFound(err) {
+		err = nil
+	}
+	c.auditChange(ctx, internal.AuditDelete, "deletion-queue", pending.OwnedRecord, nil, err)
+	if err != nil {
+		return err
+	}
+
+	if pending.Key != "" && c.ownership != nil {
+		return c.ownership.Remove(ctx, pending.Key, pending.RecordId)
+	}
+	return nil
+}
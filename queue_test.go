@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/trijpstra-fourlights/cert-manager-webhook-hetzner/internal"
+	"github.com/trijpstra-fourlights/cert-manager-webhook-hetzner/internal/hetznertest"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRetryDeletionWaitsForRecordLock(t *testing.T) {
+	fake := hetznertest.NewServer(t, fakeToken)
+	zoneId := fake.AddZone(hetznertest.Zone{Name: "example.com"})
+	fake.AddRecord("example.com", "_acme-challenge.www", "TXT", `"key1"`)
+	pending := internal.PendingDeletion{OwnedRecord: internal.OwnedRecord{
+		ZoneId:    zoneId,
+		ZoneName:  "example.com",
+		RecordId:  fake.Records("example.com")[0].Id,
+		Name:      "_acme-challenge.www",
+		Value:     "key1",
+		ApiUrl:    fake.URL(internal.ApiFlavorLegacy),
+		ApiFlavor: internal.ApiFlavorLegacy,
+	}}
+
+	client := k8sfake.NewSimpleClientset()
+	solver := &hetznerDNSProviderSolver{
+		apiToken:            fakeToken,
+		recordLeases:        internal.NewLeaseLocker(client, "default", "queue-replica", time.Second),
+		recordLeaseDuration: time.Second,
+	}
+
+	// A challenge for the same record is in progress on another replica
+	unlock, err := internal.NewLeaseLocker(client, "default", "other-replica", time.Minute).
+		Lock(context.Background(), "example.com/_acme-challenge.www.example.com")
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	if err := solver.retryDeletion(context.Background(), pending); err == nil {
+		t.Errorf("Expected the locked record not to be deleted, but got no error")
+	}
+	if values := fake.TXT("example.com", "_acme-challenge.www"); !reflect.DeepEqual(values, []string{"key1"}) {
+		t.Errorf("Expected [key1], but got %v", values)
+	}
+
+	unlock()
+	if err := solver.retryDeletion(context.Background(), pending); err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	if values := fake.TXT("example.com", "_acme-challenge.www"); values != nil {
+		t.Errorf("Expected the record to be deleted, but got %v", values)
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/trijpstra-fourlights/cert-manager-webhook-hetzner/internal"
+	"github.com/trijpstra-fourlights/cert-manager-webhook-hetzner/internal/hetznertest"
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+const fakeToken = "fake-api-token"
+
+// fakeChallenge returns a challenge for key at _acme-challenge.www.example.com solved
+// through the fake API of flavor.
+func fakeChallenge(fake *hetznertest.Server, flavor, key string) *v1alpha1.ChallengeRequest {
+	return &v1alpha1.ChallengeRequest{
+		UID:               types.UID("uid-" + key),
+		ResolvedFQDN:      "_acme-challenge.www.example.com.",
+		ResolvedZone:      "example.com.",
+		Key:               key,
+		ResourceNamespace: "default",
+		Config:            &extapi.JSON{Raw: []byte(fmt.Sprintf(`{"apiUrl":%q,"apiFlavor":%q}`, fake.URL(flavor), flavor))},
+	}
+}
+
+func TestSolverFakeAPI(t *testing.T) {
+	for _, flavor := range []string{internal.ApiFlavorLegacy, internal.ApiFlavorCloud} {
+		t.Run(flavor, func(t *testing.T) {
+			fake := hetznertest.NewServer(t, fakeToken)
+			fake.ActionPolls = 1
+			fake.AddZone(hetznertest.Zone{Name: "example.com"})
+			solver := &hetznerDNSProviderSolver{apiToken: fakeToken}
+
+			steps := []struct {
+				present  bool
+				key      string
+				expected []string
+			}{
+				{true, "key1", []string{"key1"}},
+				{true, "key2", []string{"key1", "key2"}},
+				{false, "key1", []string{"key2"}},
+				{false, "key2", nil},
+			}
+			for _, step := range steps {
+				ch := fakeChallenge(fake, flavor, step.key)
+				var err error
+				if step.present {
+					err = solver.Present(ch)
+				} else {
+					err = solver.CleanUp(ch)
+				}
+				if err != nil {
+					t.Fatalf("Expected no error for %s, but got: %v", step.key, err)
+				}
+				if values := fake.TXT("example.com", "_acme-challenge.www"); !reflect.DeepEqual(values, step.expected) {
+					t.Errorf("Expected %v after %s, but got %v", step.expected, step.key, values)
+				}
+			}
+		})
+	}
+}
+
+func TestSolverCloudCleanUpKeepsRRSet(t *testing.T) {
+	fake := hetznertest.NewServer(t, fakeToken)
+	fake.AddZone(hetznertest.Zone{Name: "example.com"})
+	solver := &hetznerDNSProviderSolver{apiToken: fakeToken}
+
+	for _, step := range []func(*v1alpha1.ChallengeRequest) error{solver.Present, solver.CleanUp} {
+		if err := step(fakeChallenge(fake, internal.ApiFlavorCloud, "key1")); err != nil {
+			t.Fatalf("Expected no error, but got: %v", err)
+		}
+	}
+	if values := fake.TXT("example.com", "_acme-challenge.www"); values != nil {
+		t.Errorf("Expected the rrset to be gone with its last value, but got %v", values)
+	}
+	// Whole rrsets could hold values added concurrently by other clusters
+	for _, request := range fake.Requests() {
+		if request.Method == http.MethodDelete {
+			t.Errorf("Expected no rrset to be deleted, but got %s %s", request.Method, request.Path)
+		}
+	}
+}
+
+func TestSolverFakeAPIErrors(t *testing.T) {
+	fake := hetznertest.NewServer(t, fakeToken)
+	fake.AddZone(hetznertest.Zone{Name: "example.com"})
+
+	// Rate limited requests are retried
+	fake.Inject(hetznertest.Fault{Method: http.MethodPost, Path: "/records", Status: http.StatusTooManyRequests, RetryAfter: "1"})
+	solver := &hetznerDNSProviderSolver{apiToken: fakeToken}
+	if err := solver.Present(fakeChallenge(fake, internal.ApiFlavorLegacy, "key1")); err != nil {
+		t.Fatalf("Expected the rate limited request to be retried, but got: %v", err)
+	}
+
+	// Server errors are reported to cert-manager
+	fake.Inject(hetznertest.Fault{Method: http.MethodPost, Path: "/records", Status: http.StatusInternalServerError})
+	if err := solver.Present(fakeChallenge(fake, internal.ApiFlavorLegacy, "key2")); err == nil {
+		t.Errorf("Expected an error, but got none")
+	}
+
+	// Rejected tokens are reported to cert-manager
+	rejected := &hetznerDNSProviderSolver{apiToken: "revoked-token"}
+	if err := rejected.Present(fakeChallenge(fake, internal.ApiFlavorLegacy, "key3")); err == nil {
+		t.Errorf("Expected an error, but got none")
+	}
+
+	if values := fake.TXT("example.com", "_acme-challenge.www"); !reflect.DeepEqual(values, []string{"key1"}) {
+		t.Errorf("Expected [key1], but got %v", values)
+	}
+}
+
+func TestSolverCleanUpUntrackedRecord(t *testing.T) {
+	testCases := []struct {
+		name             string
+		cleanupUntracked bool
+		expected         []string
+	}{
+		{"left alone by default", false, []string{"key1", "other"}},
+		{"deleted by name and value", true, []string{"other"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := hetznertest.NewServer(t, fakeToken)
+			fake.AddZone(hetznertest.Zone{Name: "example.com"})
+			// Presented before ownership tracking
+			fake.AddRecord("example.com", "_acme-challenge.www", "TXT", `"key1"`)
+			fake.AddRecord("example.com", "_acme-challenge.www", "TXT", `"other"`)
+
+			solver := &hetznerDNSProviderSolver{
+				apiToken:         fakeToken,
+				ownership:        internal.NewOwnershipStore(k8sfake.NewSimpleClientset(), "default", "ownership"),
+				cleanupUntracked: tc.cleanupUntracked,
+			}
+			if err := solver.CleanUp(fakeChallenge(fake, internal.ApiFlavorLegacy, "key1")); err != nil {
+				t.Fatalf("Expected no error, but got: %v", err)
+			}
+			if values := fake.TXT("example.com", "_acme-challenge.www"); !reflect.DeepEqual(values, tc.expected) {
+				t.Errorf("Expected %v, but got %v", tc.expected, values)
+			}
+		})
+	}
+}
+
+func TestCallDnsApiThrottleCancelled(t *testing.T) {
+	fake := hetznertest.NewServer(t, fakeToken)
+	fake.Inject(hetznertest.Fault{Method: http.MethodGet, Path: "/zones", Status: http.StatusTooManyRequests, RetryAfter: "30"})
+	config := internal.Config{ApiUrl: fake.URL(internal.ApiFlavorLegacy), ApiKey: fakeToken}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := callDnsApi(ctx, config.ApiUrl+"/zones", http.MethodGet, nil, config); err == nil {
+		t.Errorf("Expected an error, but got none")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the wait to end with the context, but got %v", elapsed)
+	}
+}
+
+func TestSolverForgetsDeletedZone(t *testing.T) {
+	for _, flavor := range []string{internal.ApiFlavorLegacy, internal.ApiFlavorCloud} {
+		t.Run(flavor, func(t *testing.T) {
+			fake := hetznertest.NewServer(t, fakeToken)
+			fake.AddZone(hetznertest.Zone{Name: "example.com"})
+			solver := &hetznerDNSProviderSolver{apiToken: fakeToken}
+			ch := fakeChallenge(fake, flavor, "key1")
+
+			// The zone was deleted and created again since it was cached
+			config := internal.Config{ApiUrl: fake.URL(flavor), ApiFlavor: flavor, ApiKey: fakeToken}
+			zoneCache.Put(internal.ZoneCacheKey(config, "example.com"), "deleted-zone", time.Now())
+
+			if err := solver.Present(ch); err == nil {
+				t.Fatalf("Expected an error for the deleted zone, but got none")
+			}
+			if err := solver.Present(ch); err != nil {
+				t.Fatalf("Expected the zone to be looked up again, but got: %v", err)
+			}
+			if values := fake.TXT("example.com", "_acme-challenge.www"); !reflect.DeepEqual(values, []string{"key1"}) {
+				t.Errorf("Expected [key1], but got %v", values)
+			}
+		})
+	}
+}
+
+func TestSolverChallengeInOtherNamespace(t *testing.T) {
+	fake := hetznertest.NewServer(t, fakeToken)
+	fake.AddZone(hetznertest.Zone{Name: "example.com"})
+	ch := fakeChallenge(fake, internal.ApiFlavorLegacy, "key1")
+	// Issued by a ClusterIssuer, whose secrets live in the cluster resource namespace
+	ch.ResourceNamespace = "cert-manager"
+	ch.DNSName = "www.example.com"
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{{Group: "acme.cert-manager.io", Version: "v1", Resource: "challenges"}: "ChallengeList"},
+		&unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "acme.cert-manager.io/v1",
+			"kind":       "Challenge",
+			"metadata":   map[string]interface{}{"name": "www-example-com", "namespace": "team-a", "uid": "challenge-uid"},
+			"spec":       map[string]interface{}{"dnsName": "www.example.com", "key": "key1"},
+		}},
+	)
+	recorder := record.NewFakeRecorder(10)
+	events := internal.NewChallengeEvents(dynamicClient, recorder)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	events.Start(stopCh)
+	var audit bytes.Buffer
+	solver := &hetznerDNSProviderSolver{
+		apiToken: fakeToken,
+		events:   events,
+		audit:    internal.NewAuditLog(internal.NewJSONLinesAuditSink(&audit)),
+	}
+
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	if len(recorder.Events) == 0 {
+		t.Errorf("Expected events on the Challenge, but got none")
+	}
+
+	var event internal.AuditEvent
+	if err := json.Unmarshal(audit.Bytes(), &event); err != nil {
+		t.Fatalf("Expected an audit event, but got: %v", err)
+	}
+	if event.Namespace != "team-a" || event.ChallengeUID != "challenge-uid" {
+		t.Errorf("Expected the namespace and UID of the Challenge, but got %q and %q", event.Namespace, event.ChallengeUID)
+	}
+}
+
+func TestChallengeFqdnWildcardDelegation(t *testing.T) {
+	cfg := hetznerDNSProviderConfig{Delegations: map[string]string{"*.customer.com": "acme.validation.net."}}
+	// The challenge of a *.customer.com certificate
+	ch := &v1alpha1.ChallengeRequest{DNSName: "customer.com", ResolvedFQDN: "_acme-challenge.customer.com."}
+
+	fqdn, err := challengeFqdn(context.Background(), cfg, ch)
+	if err != nil {
+		t.Fatalf("Expected no error, but got: %v", err)
+	}
+	if fqdn != "acme.validation.net." {
+		t.Errorf("Expected acme.validation.net., but got %s", fqdn)
+	}
+}